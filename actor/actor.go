@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/geniuscirno/go-actor/core"
 	"strings"
+	"time"
 )
 
 type PID = core.PID
@@ -30,11 +31,29 @@ func (f ActorFunc) Receive(c Context) {
 }
 
 type actorBehavior struct {
-	actor Actor
+	actor    Actor
+	receive  ReceiveFunc
+	metrics  *RequestMetrics
+	timers   *TimerScheduler
+	reliable reliableReceiver
+}
+
+func newActorBehavior(actor Actor, opts *SpawnOptions) *actorBehavior {
+	return &actorBehavior{
+		actor:    actor,
+		receive:  makeReceiverChain(actor, opts.ReceiverMiddleware),
+		metrics:  opts.RequestMetrics,
+		reliable: reliableReceiver{store: opts.ReliableInbox},
+	}
 }
 
 func (b *actorBehavior) ProcessLoop(process core.Process) error {
-	actorProcess := &actorProcess{Process: process}
+	actorProcess := &actorProcess{Process: process, behavior: b}
+	b.timers = NewTimerScheduler(actorProcess)
+	if err := b.reliable.load(process); err != nil {
+		return err
+	}
+	_, forwarder := b.actor.(reliableForwarder)
 	defer func() {
 		//if e := recover(); e != nil {
 		//	fmt.Println(e)
@@ -53,22 +72,68 @@ func (b *actorBehavior) ProcessLoop(process core.Process) error {
 			b.handleStop(actorProcess)
 			return nil
 		case message := <-channels.Mailbox:
-			b.actor.Receive(newActorContext(actorProcess, message))
+			if m, ok := message.Data.(*timerMessage); ok {
+				if !m.scheduler.accept(m) {
+					continue
+				}
+				message.Data = m.message
+			}
+			if b.handleRequestExpired(actorProcess, message) {
+				continue
+			}
+			if forwarder {
+				b.receive(newActorContext(actorProcess, message))
+				continue
+			}
+			if b.reliable.duplicate(actorProcess, message) {
+				continue
+			}
+			b.receive(newActorContext(actorProcess, message))
+			b.reliable.ack(actorProcess, message)
 		}
 	}
 }
 
+// handleRequestExpired records the age of a request and answers it with
+// core.ErrTimeout instead of handling it if the caller has already given up.
+func (b *actorBehavior) handleRequestExpired(process *actorProcess, message core.Message) bool {
+	if !message.TestFlag(core.MessageFlagRequest) {
+		return false
+	}
+
+	expired := message.Expired()
+	if !message.SentAt.IsZero() {
+		b.metrics.Observe(time.Since(message.SentAt), expired)
+	}
+	if !expired {
+		return false
+	}
+
+	// Sent aside, the loop must not wait for the mailbox of a caller that
+	// has given up anyway.
+	reply := core.Message{
+		From:      process.Self(),
+		RequestID: message.RequestID,
+		Data:      core.ErrTimeout,
+		Flag:      core.MessageFlagResponse,
+	}
+	go process.Send(message.From, reply)
+	return true
+}
+
 func (b *actorBehavior) handleStarted(process *actorProcess) {
-	b.actor.Receive(newActorContext(process, startedMessage))
+	b.receive(newActorContext(process, startedMessage))
 }
 
 func (b *actorBehavior) handleStop(process *actorProcess) {
-	b.actor.Receive(newActorContext(process, stoppingMessage))
+	b.timers.CancelAll()
+	b.receive(newActorContext(process, stoppingMessage))
 	process.StopChildren()
 }
 
 func (b *actorBehavior) handleTerminate(process *actorProcess) {
-	b.actor.Receive(newActorContext(process, stoppedMessage))
+	b.timers.CancelAll()
+	b.receive(newActorContext(process, stoppedMessage))
 }
 
 //func (b *actorBehavior) handleReply(message core.Message) {
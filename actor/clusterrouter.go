@@ -0,0 +1,76 @@
+package actor
+
+import (
+	"github.com/geniuscirno/go-actor/cluster"
+	"github.com/geniuscirno/go-actor/remote/attributes"
+)
+
+type clusterMembersChanged struct{}
+
+type clusterRouterOptions struct {
+	role *attributes.Attributes
+}
+
+type ClusterRouterOption func(opts *clusterRouterOptions)
+
+// ClusterRouterRole only routes to the nodes whose attributes match role, such
+// as {"role": "gateway"}, see cluster.Attributes.
+func ClusterRouterRole(role map[string]string) ClusterRouterOption {
+	return func(opts *clusterRouterOptions) {
+		opts.role = attributes.New(role)
+	}
+}
+
+type clusterGroupRouter struct {
+	router
+	cluster *Cluster
+	name    string
+	opts    clusterRouterOptions
+	cancel  func()
+}
+
+// NewClusterGroupRouter returns an actor routing the messages it receives with
+// strategy to the actors spawned with Name(name) on every node of cluster,
+// including the local node, or on the nodes of a role with ClusterRouterRole.
+// The routees follow the members of the cluster, so that a Broadcast reaches
+// the actor of every node currently in the cluster.
+func NewClusterGroupRouter(cluster *Cluster, strategy RouterStrategy, name string, opt ...ClusterRouterOption) Actor {
+	r := &clusterGroupRouter{
+		router:  router{strategy: strategy},
+		cluster: cluster,
+		name:    name,
+	}
+	for _, o := range opt {
+		o(&r.opts)
+	}
+	return r
+}
+
+func (r *clusterGroupRouter) Receive(c Context) {
+	switch c.Message().(type) {
+	case *Started:
+		self := c.Self()
+		r.cancel = r.cluster.WatchMembers(func(members []string) {
+			// Sent from another goroutine since the cluster must not be
+			// blocked by a full mailbox. Notifications may arrive out of
+			// order, so the router reads the latest members itself.
+			go c.SendCtx(c.Context(), self, &clusterMembersChanged{})
+		})
+		r.update()
+	case *Stopped:
+		r.cancel()
+	case *clusterMembersChanged:
+		r.update()
+	default:
+		r.receive(c)
+	}
+}
+
+func (r *clusterGroupRouter) update() {
+	members := r.cluster.FindMembers(cluster.Constraint{Attributes: r.opts.role})
+	routees := make([]PID, 0, len(members))
+	for _, member := range members {
+		routees = append(routees, PID{Node: member, ID: r.name})
+	}
+	r.setRoutees(routees)
+}
@@ -1,6 +1,8 @@
 package actor
 
 import (
+	"time"
+
 	"github.com/geniuscirno/go-actor/core"
 )
 
@@ -11,6 +13,11 @@ type Context interface {
 	Error(err error) error
 	HandleCall(reply interface{}, err error) error
 	From() PID
+	Deadline() (time.Time, bool)
+	Header(key string) string
+	Stream() (*ServerStream, error)
+	Timers() *TimerScheduler
+	Forward(to PID) error
 }
 
 type actorContext struct {
@@ -52,6 +59,44 @@ func (c *actorContext) From() PID {
 	return PID{}
 }
 
+// Deadline returns the time after which the caller of the current request no
+// longer waits for a reply.
+func (c *actorContext) Deadline() (time.Time, bool) {
+	if m, ok := c.message.(core.Message); ok && !m.Deadline.IsZero() {
+		return m.Deadline, true
+	}
+	return time.Time{}, false
+}
+
+func (c *actorContext) Header(key string) string {
+	if m, ok := c.message.(core.Message); ok {
+		return m.Header[key]
+	}
+	return ""
+}
+
+// Stream answers a request opened with OpenStream. The returned stream may be
+// used after Receive returns, e.g. from another goroutine.
+func (c *actorContext) Stream() (*ServerStream, error) {
+	m, ok := c.message.(core.Message)
+	if !ok || !m.TestFlag(core.MessageFlagStreamRequest) {
+		return nil, ErrNotStream
+	}
+	return newServerStream(c.Process, m.From)
+}
+
+// Timers returns the scheduler owned by the actor, its timers are cancelled
+// when the actor stops.
+func (c *actorContext) Timers() *TimerScheduler {
+	return c.behavior.timers
+}
+
+// Forward sends the current message to another process keeping its original
+// sender, so that replies go straight back to the sender.
+func (c *actorContext) Forward(to PID) error {
+	return c.Send(to, c.message)
+}
+
 func (c *actorContext) HandleCall(reply interface{}, err error) error {
 	if err != nil {
 		return c.Error(err)
@@ -0,0 +1,447 @@
+package actor
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geniuscirno/go-actor/core"
+)
+
+// CronSchedule is a parsed standard five-field cron expression
+// (minute hour day-of-month month day-of-week). Fields accept *, lists, ranges
+// and steps, months and weekdays also accept three-letter names. The
+// descriptors @yearly, @monthly, @weekly, @daily and @hourly are supported.
+type CronSchedule struct {
+	spec   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// domStar and dowStar follow cron: when both day fields are restricted a
+	// day matches if either of them does.
+	domStar bool
+	dowStar bool
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMinute = cronField{min: 0, max: 59}
+	cronHour   = cronField{min: 0, max: 23}
+	cronDom    = cronField{min: 1, max: 31}
+	cronMonth  = cronField{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDow = cronField{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func ParseCron(spec string) (*CronSchedule, error) {
+	expr := strings.TrimSpace(spec)
+	if d, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: expected 5 fields, found %d: %q", len(fields), spec)
+	}
+
+	s := &CronSchedule{spec: spec}
+	var err error
+	if s.minute, err = cronMinute.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = cronHour.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, err = cronDom.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = cronMonth.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, err = cronDow.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	// 7 is an alias of Sunday.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+	return s, nil
+}
+
+func (f cronField) parse(field string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		b, err := f.parsePart(part)
+		if err != nil {
+			return 0, err
+		}
+		set |= b
+	}
+	return set, nil
+}
+
+func (f cronField) parsePart(part string) (uint64, error) {
+	rangePart, step := part, 1
+	if i := strings.Index(part, "/"); i >= 0 {
+		n, err := strconv.Atoi(part[i+1:])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("cron: invalid step in %q", part)
+		}
+		rangePart, step = part[:i], n
+	}
+
+	var lo, hi int
+	switch {
+	case rangePart == "*" || rangePart == "?":
+		lo, hi = f.min, f.max
+	case strings.Contains(rangePart, "-"):
+		bounds := strings.SplitN(rangePart, "-", 2)
+		var err error
+		if lo, err = f.value(bounds[0]); err != nil {
+			return 0, err
+		}
+		if hi, err = f.value(bounds[1]); err != nil {
+			return 0, err
+		}
+	default:
+		v, err := f.value(rangePart)
+		if err != nil {
+			return 0, err
+		}
+		lo, hi = v, v
+		// "5/15" means from 5 to the end of the range every 15.
+		if step > 1 {
+			hi = f.max
+		}
+	}
+	if lo > hi {
+		return 0, fmt.Errorf("cron: invalid range %q", part)
+	}
+
+	var set uint64
+	for v := lo; v <= hi; v += step {
+		set |= 1 << uint(v)
+	}
+	return set, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("cron: invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("cron: value %d out of range [%d, %d]", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (s *CronSchedule) String() string {
+	return s.spec
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first activation strictly after t, in the location of t.
+// It returns the zero time if the schedule never fires, e.g. on February 30.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			// A daylight saving transition may map the next hour back onto
+			// the current one.
+			if !next.After(t) {
+				n := t.Add(time.Hour)
+				next = time.Date(n.Year(), n.Month(), n.Day(), n.Hour(), 0, 0, 0, loc)
+			}
+			t = next
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			if m := s.minute >> uint(t.Minute()); m != 0 {
+				t = t.Add(time.Duration(bits.TrailingZeros64(m)) * time.Minute)
+			} else {
+				t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			}
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// MisfirePolicy decides what happens to the activations of a cron schedule
+// that were missed while it was not running, e.g. during a node restart. It
+// needs a CronStore that keeps the last activation across restarts, SendCron
+// fails with ErrCronStoreRequired if a policy other than MisfireSkip is given
+// without CronStorage.
+type MisfirePolicy int
+
+const (
+	// MisfireSkip ignores missed activations.
+	MisfireSkip MisfirePolicy = iota
+	// MisfireFireOnce sends the message once if any activation was missed.
+	MisfireFireOnce
+	// MisfireFireAll sends the message once per missed activation, up to
+	// maxMisfires.
+	MisfireFireAll
+)
+
+const maxMisfires = 1000
+
+var ErrCronStoreRequired = errors.New("cron misfire policy requires a CronStore")
+
+type cronOptions struct {
+	key     string
+	misfire MisfirePolicy
+	store   CronStore
+}
+
+type CronOption func(opts *cronOptions)
+
+// CronKey names the schedule, it identifies the schedule in the CronStore and
+// in Schedules. Defaults to the target and the spec.
+func CronKey(key string) CronOption {
+	return func(opts *cronOptions) {
+		opts.key = key
+	}
+}
+
+func CronMisfire(policy MisfirePolicy) CronOption {
+	return func(opts *cronOptions) {
+		opts.misfire = policy
+	}
+}
+
+// CronStorage records the last activation of the schedule in store, by
+// default in memory only.
+func CronStorage(store CronStore) CronOption {
+	return func(opts *cronOptions) {
+		opts.store = store
+	}
+}
+
+type ScheduleInfo struct {
+	Key      string
+	To       PID
+	Spec     string
+	Location *time.Location
+	Misfire  MisfirePolicy
+	Next     time.Time
+	LastFire time.Time
+}
+
+type cronEntry struct {
+	*timer
+	info     ScheduleInfo
+	schedule *CronSchedule
+	message  interface{}
+	store    CronStore
+}
+
+// SendCron sends message to to at every activation of the cron spec, evaluated
+// in loc (time.Local if nil). A schedule with the same key is replaced.
+func (s *TimerScheduler) SendCron(to PID, message interface{}, spec string, loc *time.Location, opt ...CronOption) (CancelFunc, error) {
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	opts := cronOptions{key: fmt.Sprintf("%s %s", to, spec)}
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.store == nil {
+		// The memory store forgets the last activation on restart, the
+		// misfire policy would never apply.
+		if opts.misfire != MisfireSkip {
+			return nil, ErrCronStoreRequired
+		}
+		opts.store = NewMemoryCronStore()
+	}
+
+	lastFire, _, err := opts.store.LastFire(opts.key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if e, ok := s.crons[opts.key]; ok {
+		e.cancel()
+	}
+	s.nextID++
+	e := &cronEntry{
+		timer: s.newTimer(s.nextID),
+		info: ScheduleInfo{
+			Key:      opts.key,
+			To:       to,
+			Spec:     spec,
+			Location: loc,
+			Misfire:  opts.misfire,
+			LastFire: lastFire,
+		},
+		schedule: schedule,
+		message:  message,
+		store:    opts.store,
+	}
+	s.crons[opts.key] = e
+	s.mu.Unlock()
+
+	go s.runCron(e)
+	return func() { s.removeCron(e) }, nil
+}
+
+func (s *TimerScheduler) removeCron(e *cronEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.cancel()
+	if s.crons[e.info.Key] == e {
+		delete(s.crons, e.info.Key)
+	}
+}
+
+// Schedules lists the active cron schedules.
+func (s *TimerScheduler) Schedules() []ScheduleInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]ScheduleInfo, 0, len(s.crons))
+	for _, e := range s.crons {
+		results = append(results, e.info)
+	}
+	return results
+}
+
+func (s *TimerScheduler) Schedule(key string) (ScheduleInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.crons[key]
+	if !ok {
+		return ScheduleInfo{}, false
+	}
+	return e.info, true
+}
+
+func (s *TimerScheduler) CancelSchedule(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.crons[key]; ok {
+		e.cancel()
+		delete(s.crons, key)
+	}
+}
+
+func (s *TimerScheduler) runCron(e *cronEntry) {
+	now := time.Now().In(e.info.Location)
+	from := now
+	if !e.info.LastFire.IsZero() && e.info.Misfire != MisfireSkip {
+		var missed []time.Time
+		for t := e.schedule.Next(e.info.LastFire.In(e.info.Location)); !t.IsZero() && !t.After(now); t = e.schedule.Next(t) {
+			missed = append(missed, t)
+			if len(missed) >= maxMisfires {
+				break
+			}
+		}
+		if e.info.Misfire == MisfireFireOnce && len(missed) > 0 {
+			missed = missed[len(missed)-1:]
+		}
+		for _, t := range missed {
+			if !s.fireCron(e, t) {
+				return
+			}
+		}
+	}
+
+	for {
+		next := e.schedule.Next(from)
+		if next.IsZero() {
+			s.removeCron(e)
+			return
+		}
+		s.mu.Lock()
+		e.info.Next = next
+		s.mu.Unlock()
+
+		tm := time.NewTimer(time.Until(next))
+		select {
+		case <-e.ctx.Done():
+			tm.Stop()
+			return
+		case <-tm.C:
+		}
+
+		if !s.fireCron(e, next) {
+			return
+		}
+		from = next
+	}
+}
+
+func (s *TimerScheduler) fireCron(e *cronEntry, at time.Time) bool {
+	if err := s.process.SendCtx(e.ctx, e.info.To, core.Message{From: s.process.Self(), Data: e.message}); err != nil && e.ctx.Err() != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	e.info.LastFire = at
+	s.mu.Unlock()
+
+	if err := e.store.SaveLastFire(e.info.Key, at); err != nil {
+		log.Println("actor: save cron last fire failed:", e.info.Key, err)
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package actor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/internal/fileutil"
+)
+
+// CronStore keeps the last activation of cron schedules so that missed
+// activations can be detected after a restart.
+type CronStore interface {
+	LastFire(key string) (time.Time, bool, error)
+	SaveLastFire(key string, t time.Time) error
+}
+
+type memoryCronStore struct {
+	mu    sync.Mutex
+	fires map[string]time.Time
+}
+
+// NewMemoryCronStore returns a CronStore that does not survive restarts, it
+// is the default store of the schedules skipping misfires.
+func NewMemoryCronStore() CronStore {
+	return &memoryCronStore{fires: make(map[string]time.Time)}
+}
+
+func (s *memoryCronStore) LastFire(key string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.fires[key]
+	return t, ok, nil
+}
+
+func (s *memoryCronStore) SaveLastFire(key string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fires[key] = t
+	return nil
+}
+
+type fileCronStore struct {
+	path string
+
+	mu    sync.Mutex
+	fires map[string]time.Time
+}
+
+// NewFileCronStore returns a CronStore that keeps the last activations in a
+// JSON file at path.
+func NewFileCronStore(path string) (CronStore, error) {
+	s := &fileCronStore{path: path, fires: make(map[string]time.Time)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &s.fires); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *fileCronStore) LastFire(key string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.fires[key]
+	return t, ok, nil
+}
+
+func (s *fileCronStore) SaveLastFire(key string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fires[key] = t
+	b, err := json.Marshal(s.fires)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(s.path, b)
+}
@@ -0,0 +1,38 @@
+package actor
+
+import (
+	"reflect"
+
+	"github.com/geniuscirno/go-actor/core"
+)
+
+type (
+	EventStream    = core.EventStream
+	Subscription   = core.Subscription
+	ProcessStarted = core.ProcessStarted
+	ProcessStopped = core.ProcessStopped
+	DeadLetter     = core.DeadLetter
+)
+
+// EventTypes returns a predicate matching the events of the same Go type as
+// one of events, e.g. EventTypes((*DeadLetter)(nil)).
+func EventTypes(events ...interface{}) func(event interface{}) bool {
+	types := make(map[reflect.Type]struct{}, len(events))
+	for _, e := range events {
+		types[reflect.TypeOf(e)] = struct{}{}
+	}
+	return func(event interface{}) bool {
+		_, ok := types[reflect.TypeOf(event)]
+		return ok
+	}
+}
+
+// Subscribe delivers the events of the node's event stream matching predicate
+// to the process until it dies or the subscription is cancelled.
+func (p *actorProcess) Subscribe(predicate func(event interface{}) bool) (*Subscription, error) {
+	return p.Node().EventStream().Subscribe(p.Self(), predicate)
+}
+
+func (p *actorProcess) Publish(event interface{}) {
+	p.Node().EventStream().Publish(event)
+}
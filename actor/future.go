@@ -94,7 +94,7 @@ func (fp *futureProcess) ProcessLoop(process core.Process) error {
 	case <-process.Context().Done():
 		fp.SetErr(process.Context().Err())
 	case <-timer.C:
-		fp.SetErr(errors.New("timeout"))
+		fp.SetErr(core.ErrTimeout)
 	}
 	return nil
 }
@@ -0,0 +1,98 @@
+package actor
+
+import (
+	"context"
+	"time"
+
+	"github.com/geniuscirno/go-actor/cluster"
+	"github.com/geniuscirno/go-actor/core"
+)
+
+const DefaultGrainIdleTimeout = time.Minute * 10
+
+type grainOptions struct {
+	idleTimeout time.Duration
+	spawnOpts   []SpawnOption
+}
+
+type GrainOption func(opts *grainOptions)
+
+// GrainIdleTimeout sets how long a grain stays active without receiving a
+// message, 0 keeps it active until its node stops.
+func GrainIdleTimeout(d time.Duration) GrainOption {
+	return func(opts *grainOptions) {
+		opts.idleTimeout = d
+	}
+}
+
+// GrainSpawnOptions sets the options the grains are spawned with, their name
+// is set by the cluster.
+func GrainSpawnOptions(opt ...SpawnOption) GrainOption {
+	return func(opts *grainOptions) {
+		opts.spawnOpts = opt
+	}
+}
+
+// RegisterGrain registers the grains of kind, producer returns the actor of
+// the grain of identity when it is activated. Every node of the cluster must
+// register the same kinds.
+func (c *Cluster) RegisterGrain(kind string, producer func(identity string) Actor, opt ...GrainOption) {
+	opts := &grainOptions{idleTimeout: DefaultGrainIdleTimeout}
+	for _, o := range opt {
+		o(opts)
+	}
+
+	c.RegisterKind(kind, func(identity string) core.ProcessBehavior {
+		a := &grainActor{actor: producer(identity), idleTimeout: opts.idleTimeout}
+		return newActorBehavior(a, newSpawnOptions(opts.spawnOpts))
+	})
+}
+
+// Grain is the handle of a grain, the grain is activated by the first message
+// sent to it.
+type Grain struct {
+	PID  PID
+	root Process
+}
+
+// Get returns the handle of the grain of kind and identity. Its PID has no
+// node, the cluster sends the messages to the node where the grain is active.
+func (c *Cluster) Get(kind string, identity string) *Grain {
+	return &Grain{PID: PID{ID: cluster.GrainID(kind, identity)}, root: c.root}
+}
+
+func (g *Grain) Send(ctx context.Context, message interface{}) error {
+	return g.root.SendCtx(ctx, g.PID, message)
+}
+
+func (g *Grain) Call(ctx context.Context, message interface{}) *Future {
+	return g.root.CallCtx(ctx, g.PID, message)
+}
+
+type grainIdleCheck struct{}
+
+// grainActor stops the grain once it has been idle for idleTimeout, the next
+// message activates it again.
+type grainActor struct {
+	actor       Actor
+	idleTimeout time.Duration
+	lastActive  time.Time
+}
+
+func (a *grainActor) Receive(c Context) {
+	switch c.Message().(type) {
+	case *grainIdleCheck:
+		// A queued message keeps the grain active, the messages queued
+		// after the check are forwarded to its next activation.
+		if time.Since(a.lastActive) >= a.idleTimeout && len(c.ProcessChannels().Mailbox) == 0 {
+			c.Stop()
+		}
+		return
+	case *Started:
+		if a.idleTimeout > 0 {
+			c.Timers().StartPeriodicTimer("grain-idle", &grainIdleCheck{}, a.idleTimeout/2)
+		}
+	}
+	a.lastActive = time.Now()
+	a.actor.Receive(c)
+}
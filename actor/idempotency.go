@@ -0,0 +1,101 @@
+package actor
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type idempotencyEntry struct {
+	key string
+	at  time.Time
+
+	// The reply may be given outside of the actor loop.
+	mu      sync.Mutex
+	replied bool
+	reply   interface{}
+	// waiting are the duplicates received before the reply, they are answered
+	// with it.
+	waiting []Context
+}
+
+// wait answers c with the reply once it is given.
+func (e *idempotencyEntry) wait(c Context) {
+	e.mu.Lock()
+	if !e.replied {
+		e.waiting = append(e.waiting, c)
+		e.mu.Unlock()
+		return
+	}
+	reply := e.reply
+	e.mu.Unlock()
+	c.Reply(reply)
+}
+
+type idempotencyContext struct {
+	embeddedContext
+	entry *idempotencyEntry
+}
+
+func (c *idempotencyContext) Reply(message interface{}) error {
+	c.entry.mu.Lock()
+	c.entry.replied = true
+	c.entry.reply = message
+	waiting := c.entry.waiting
+	c.entry.waiting = nil
+	c.entry.mu.Unlock()
+
+	for _, w := range waiting {
+		w.Reply(message)
+	}
+	return c.embeddedContext.Reply(message)
+}
+
+func (c *idempotencyContext) Error(err error) error {
+	return c.Reply(err)
+}
+
+func (c *idempotencyContext) HandleCall(reply interface{}, err error) error {
+	if err != nil {
+		return c.Error(err)
+	}
+	return c.Reply(reply)
+}
+
+// IdempotencyMiddleware suppresses messages carrying an idempotency key that
+// has already been seen within window. A duplicate request is answered with
+// the reply of the first one, at once if it has replied, otherwise once it
+// replies.
+func IdempotencyMiddleware(window time.Duration) ReceiverMiddleware {
+	return func(next ReceiveFunc) ReceiveFunc {
+		entries := make(map[string]*list.Element)
+		order := list.New()
+
+		return func(c Context) {
+			key := c.Header(HeaderIdempotencyKey)
+			if key == "" {
+				next(c)
+				return
+			}
+
+			now := time.Now()
+			for e := order.Front(); e != nil; e = order.Front() {
+				entry := e.Value.(*idempotencyEntry)
+				if now.Sub(entry.at) < window {
+					break
+				}
+				order.Remove(e)
+				delete(entries, entry.key)
+			}
+
+			if e, ok := entries[key]; ok {
+				e.Value.(*idempotencyEntry).wait(c)
+				return
+			}
+
+			entry := &idempotencyEntry{key: key, at: now}
+			entries[key] = order.PushBack(entry)
+			next(&idempotencyContext{embeddedContext: c, entry: entry})
+		}
+	}
+}
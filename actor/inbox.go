@@ -0,0 +1,187 @@
+package actor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/geniuscirno/go-actor/internal/fileutil"
+)
+
+// InboxWindow is what a receiver records of a reliable channel to discard its
+// duplicates: every sequence number below Next has been handled, and so have
+// the ones in Seen.
+type InboxWindow struct {
+	Next uint64   `json:"next"`
+	Seen []uint64 `json:"seen,omitempty"`
+}
+
+// InboxStore keeps the windows of the reliable channels a receiver has
+// handled messages of, see ReliableInbox.
+type InboxStore interface {
+	// Load returns the windows of receiver by channel.
+	Load(receiver string) (map[string]InboxWindow, error)
+	Save(receiver string, channel string, w InboxWindow) error
+}
+
+type memoryInboxStore struct {
+	mu        sync.Mutex
+	receivers map[string]map[string]InboxWindow
+}
+
+// NewMemoryInboxStore returns an InboxStore that survives the restarts of the
+// receivers but not of the node.
+func NewMemoryInboxStore() InboxStore {
+	return &memoryInboxStore{receivers: make(map[string]map[string]InboxWindow)}
+}
+
+func (s *memoryInboxStore) Load(receiver string) (map[string]InboxWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows := make(map[string]InboxWindow, len(s.receivers[receiver]))
+	for channel, w := range s.receivers[receiver] {
+		windows[channel] = w
+	}
+	return windows, nil
+}
+
+func (s *memoryInboxStore) Save(receiver string, channel string, w InboxWindow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows, ok := s.receivers[receiver]
+	if !ok {
+		windows = make(map[string]InboxWindow)
+		s.receivers[receiver] = windows
+	}
+	windows[channel] = w
+	return nil
+}
+
+type fileInboxStore struct {
+	dir string
+
+	mu        sync.Mutex
+	receivers map[string]map[string]InboxWindow
+	lines     map[string]int
+}
+
+// inboxRecord is a line of the file of a receiver, saving the window of
+// Channel.
+type inboxRecord struct {
+	Channel string `json:"channel"`
+	InboxWindow
+}
+
+// inboxCompactLines is how many lines the file of a receiver may have beyond
+// twice its windows before it is rewritten with only them.
+const inboxCompactLines = 64
+
+// NewFileInboxStore returns an InboxStore appending the windows of every
+// receiver as JSON lines to a file under dir, rewritten with only the latest
+// window of each channel once most lines are outdated.
+func NewFileInboxStore(dir string) (InboxStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileInboxStore{
+		dir:       dir,
+		receivers: make(map[string]map[string]InboxWindow),
+		lines:     make(map[string]int),
+	}, nil
+}
+
+func (s *fileInboxStore) path(receiver string) string {
+	return filepath.Join(s.dir, url.PathEscape(receiver)+".inbox")
+}
+
+// windows returns the windows of receiver, reading its file the first time,
+// s.mu must be held.
+func (s *fileInboxStore) windows(receiver string) (map[string]InboxWindow, error) {
+	if windows, ok := s.receivers[receiver]; ok {
+		return windows, nil
+	}
+
+	windows := make(map[string]InboxWindow)
+	var lines int
+	err := fileutil.ReadLines(s.path(receiver), func(line []byte) error {
+		r := &inboxRecord{}
+		if err := json.Unmarshal(line, r); err != nil {
+			return fmt.Errorf("inbox: corrupted window of %s: %w", receiver, err)
+		}
+		windows[r.Channel] = r.InboxWindow
+		lines++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.receivers[receiver] = windows
+	s.lines[receiver] = lines
+	return windows, nil
+}
+
+func (s *fileInboxStore) Load(receiver string) (map[string]InboxWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows, err := s.windows(receiver)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]InboxWindow, len(windows))
+	for channel, w := range windows {
+		results[channel] = w
+	}
+	return results, nil
+}
+
+func (s *fileInboxStore) Save(receiver string, channel string, w InboxWindow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows, err := s.windows(receiver)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(&inboxRecord{Channel: channel, InboxWindow: w})
+	if err != nil {
+		return err
+	}
+	if err := fileutil.AppendFile(s.path(receiver), append(b, '\n')); err != nil {
+		return err
+	}
+	windows[channel] = w
+	s.lines[receiver]++
+	s.compact(receiver)
+	return nil
+}
+
+// compact rewrites the file of receiver with its latest windows once most of
+// its lines are outdated, s.mu must be held.
+func (s *fileInboxStore) compact(receiver string) {
+	windows := s.receivers[receiver]
+	if s.lines[receiver] <= 2*len(windows)+inboxCompactLines {
+		return
+	}
+
+	var b []byte
+	for channel, w := range windows {
+		line, err := json.Marshal(&inboxRecord{Channel: channel, InboxWindow: w})
+		if err != nil {
+			log.Printf("actor: compact inbox %s failed: %v\n", receiver, err)
+			return
+		}
+		b = append(append(b, line...), '\n')
+	}
+	if err := fileutil.WriteFile(s.path(receiver), b); err != nil {
+		log.Printf("actor: compact inbox %s failed: %v\n", receiver, err)
+		return
+	}
+	s.lines[receiver] = len(windows)
+}
@@ -0,0 +1,118 @@
+package actor
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRequestMetrics collects the request age of every actor spawned
+// without WithRequestMetrics.
+var DefaultRequestMetrics = NewRequestMetrics()
+
+var requestAgeBuckets = []time.Duration{
+	time.Millisecond,
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 500,
+	time.Second,
+	time.Second * 5,
+	time.Second * 10,
+	time.Second * 30,
+}
+
+// RequestMetrics tracks how long requests made with Call wait in the
+// responder's mailbox before they are handled, and how many of them had
+// already expired by then. The age is measured against the caller's clock, so
+// requests coming from other nodes are subject to clock skew.
+//
+// The counters are updated atomically rather than under a lock, as every
+// request of every actor observes them, so a snapshot taken while requests
+// are observed may be off by those requests.
+type RequestMetrics struct {
+	count   int64
+	expired int64
+	sum     time.Duration
+	max     time.Duration
+	buckets []int64
+}
+
+type RequestAgeBucket struct {
+	// UpperBound is the inclusive upper bound of the bucket, the last bucket
+	// has no upper bound and reports zero.
+	UpperBound time.Duration
+	Count      int64
+}
+
+type RequestMetricsSnapshot struct {
+	Count   int64
+	Expired int64
+	Sum     time.Duration
+	Max     time.Duration
+	Buckets []RequestAgeBucket
+}
+
+func (s RequestMetricsSnapshot) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
+
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{buckets: make([]int64, len(requestAgeBuckets)+1)}
+}
+
+func (m *RequestMetrics) Observe(age time.Duration, expired bool) {
+	if m == nil {
+		return
+	}
+
+	i := 0
+	for ; i < len(requestAgeBuckets); i++ {
+		if age <= requestAgeBuckets[i] {
+			break
+		}
+	}
+
+	atomic.AddInt64(&m.count, 1)
+	if expired {
+		atomic.AddInt64(&m.expired, 1)
+	}
+	atomic.AddInt64((*int64)(&m.sum), int64(age))
+	for {
+		max := atomic.LoadInt64((*int64)(&m.max))
+		if int64(age) <= max || atomic.CompareAndSwapInt64((*int64)(&m.max), max, int64(age)) {
+			break
+		}
+	}
+	atomic.AddInt64(&m.buckets[i], 1)
+}
+
+func (m *RequestMetrics) Snapshot() RequestMetricsSnapshot {
+	s := RequestMetricsSnapshot{
+		Count:   atomic.LoadInt64(&m.count),
+		Expired: atomic.LoadInt64(&m.expired),
+		Sum:     time.Duration(atomic.LoadInt64((*int64)(&m.sum))),
+		Max:     time.Duration(atomic.LoadInt64((*int64)(&m.max))),
+		Buckets: make([]RequestAgeBucket, len(m.buckets)),
+	}
+	for i := range m.buckets {
+		if i < len(requestAgeBuckets) {
+			s.Buckets[i].UpperBound = requestAgeBuckets[i]
+		}
+		s.Buckets[i].Count = atomic.LoadInt64(&m.buckets[i])
+	}
+	return s
+}
+
+func (m *RequestMetrics) Reset() {
+	atomic.StoreInt64(&m.count, 0)
+	atomic.StoreInt64(&m.expired, 0)
+	atomic.StoreInt64((*int64)(&m.sum), 0)
+	atomic.StoreInt64((*int64)(&m.max), 0)
+	for i := range m.buckets {
+		atomic.StoreInt64(&m.buckets[i], 0)
+	}
+}
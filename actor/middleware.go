@@ -0,0 +1,19 @@
+package actor
+
+type ReceiveFunc func(c Context)
+
+// embeddedContext lets middlewares embed a Context, whose Context method
+// would otherwise clash with the field name.
+type embeddedContext = Context
+
+// ReceiverMiddleware wraps the Receive of an actor, it sees every message
+// including lifecycle messages before the actor does.
+type ReceiverMiddleware func(next ReceiveFunc) ReceiveFunc
+
+func makeReceiverChain(actor Actor, middlewares []ReceiverMiddleware) ReceiveFunc {
+	receive := ReceiveFunc(actor.Receive)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		receive = middlewares[i](receive)
+	}
+	return receive
+}
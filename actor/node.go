@@ -3,7 +3,6 @@ package actor
 import (
 	"github.com/geniuscirno/go-actor/cluster"
 	"github.com/geniuscirno/go-actor/core"
-	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
 type Node struct {
@@ -24,14 +23,8 @@ func NewNode(name string) *Node {
 }
 
 func (n *Node) SpawnActor(actor Actor, opt ...SpawnOption) (Process, error) {
-	opts := &core.SpawnOptions{}
-	for _, o := range opt {
-		o(opts)
-	}
-
-	p, err := n.Spawn(&actorBehavior{
-		actor: actor,
-	}, opts)
+	opts := newSpawnOptions(opt)
+	p, err := n.Spawn(newActorBehavior(actor, opts), &opts.SpawnOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -39,26 +32,21 @@ func (n *Node) SpawnActor(actor Actor, opt ...SpawnOption) (Process, error) {
 }
 
 type Cluster struct {
-	core.Cluster
+	*cluster.Cluster
+	root Process
 }
 
-func NewCluster(node *Node, client *clientv3.Client, opt ...cluster.Option) (*Cluster, error) {
-	c, err := cluster.NewCluster(node.Node, client, opt...)
+func NewCluster(node *Node, backend cluster.Backend, opt ...cluster.Option) (*Cluster, error) {
+	c, err := cluster.NewCluster(node.Node, backend, opt...)
 	if err != nil {
 		return nil, err
 	}
-	return &Cluster{Cluster: c}, nil
+	return &Cluster{Cluster: c, root: node.Root}, nil
 }
 
 func (c *Cluster) SpawnActor(actor Actor, opt ...SpawnOption) (Process, error) {
-	opts := &core.SpawnOptions{}
-	for _, o := range opt {
-		o(opts)
-	}
-
-	p, err := c.Spawn(&actorBehavior{
-		actor: actor,
-	}, opts)
+	opts := newSpawnOptions(opt)
+	p, err := c.SpawnConstrained(newActorBehavior(actor, opts), &opts.SpawnOptions, opts.Constraints...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,340 @@
+package actor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/geniuscirno/go-actor/internal/fileutil"
+	"github.com/geniuscirno/go-actor/remote"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// OutboxEntry is a message of a reliable channel waiting for its ack.
+type OutboxEntry struct {
+	Seq     uint64
+	Message interface{}
+}
+
+// OutboxStore keeps the unacknowledged messages of reliable channels, and the
+// highest sequence number each channel has used so that a reopened channel
+// never reuses one, even once all its messages have been acknowledged.
+type OutboxStore interface {
+	Append(channel string, e OutboxEntry) error
+	Remove(channel string, seq uint64) error
+	// Load returns the entries of channel ordered by Seq.
+	Load(channel string) ([]OutboxEntry, error)
+	// NextSeq returns the sequence number following the highest one set
+	// with SetSeq, 1 for a new channel.
+	NextSeq(channel string) (uint64, error)
+	SetSeq(channel string, seq uint64) error
+}
+
+type memoryOutboxStore struct {
+	mu       sync.Mutex
+	channels map[string]map[uint64]interface{}
+	seqs     map[string]uint64
+}
+
+// NewMemoryOutboxStore returns an OutboxStore that does not survive restarts,
+// it is the default store of OpenReliableChannel.
+func NewMemoryOutboxStore() OutboxStore {
+	return &memoryOutboxStore{
+		channels: make(map[string]map[uint64]interface{}),
+		seqs:     make(map[string]uint64),
+	}
+}
+
+func (s *memoryOutboxStore) Append(channel string, e OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, ok := s.channels[channel]
+	if !ok {
+		entries = make(map[uint64]interface{})
+		s.channels[channel] = entries
+	}
+	entries[e.Seq] = e.Message
+	return nil
+}
+
+func (s *memoryOutboxStore) Remove(channel string, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.channels[channel], seq)
+	return nil
+}
+
+func (s *memoryOutboxStore) Load(channel string) ([]OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]OutboxEntry, 0, len(s.channels[channel]))
+	for seq, message := range s.channels[channel] {
+		results = append(results, OutboxEntry{Seq: seq, Message: message})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Seq < results[j].Seq })
+	return results, nil
+}
+
+func (s *memoryOutboxStore) NextSeq(channel string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.seqs[channel] + 1, nil
+}
+
+func (s *memoryOutboxStore) SetSeq(channel string, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq > s.seqs[channel] {
+		s.seqs[channel] = seq
+	}
+	return nil
+}
+
+type fileOutboxStore struct {
+	dir string
+
+	mu       sync.Mutex
+	channels map[string]map[uint64][]byte
+	lines    map[string]int
+	seqs     map[string]uint64
+}
+
+// outboxRecord is a line of the file of a channel, appending or removing the
+// entry Seq.
+type outboxRecord struct {
+	Seq     uint64 `json:"seq"`
+	Data    []byte `json:"data,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+// outboxCompactLines is how many lines the file of a channel may have beyond
+// twice its entries before it is rewritten with only them.
+const outboxCompactLines = 64
+
+// NewFileOutboxStore returns an OutboxStore appending the entries of every
+// channel and their removals as JSON lines to a file under dir, rewritten
+// with only the remaining entries once most lines are removed ones. The
+// highest sequence number of a channel is kept in a .seq file next to it.
+// The messages must be proto messages.
+func NewFileOutboxStore(dir string) (OutboxStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileOutboxStore{
+		dir:      dir,
+		channels: make(map[string]map[uint64][]byte),
+		lines:    make(map[string]int),
+		seqs:     make(map[string]uint64),
+	}, nil
+}
+
+func (s *fileOutboxStore) path(channel string) string {
+	return filepath.Join(s.dir, url.PathEscape(channel)+".outbox")
+}
+
+// entries returns the entries of channel, reading its file the first time,
+// s.mu must be held.
+func (s *fileOutboxStore) entries(channel string) (map[uint64][]byte, error) {
+	if entries, ok := s.channels[channel]; ok {
+		return entries, nil
+	}
+
+	entries := make(map[uint64][]byte)
+	var lines int
+	err := fileutil.ReadLines(s.path(channel), func(line []byte) error {
+		r := &outboxRecord{}
+		if err := json.Unmarshal(line, r); err != nil {
+			return fmt.Errorf("outbox: corrupted entry of %s: %w", channel, err)
+		}
+		if r.Removed {
+			delete(entries, r.Seq)
+		} else {
+			entries[r.Seq] = r.Data
+		}
+		lines++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.channels[channel] = entries
+	s.lines[channel] = lines
+	return entries, nil
+}
+
+// append writes r to the file of channel, s.mu must be held.
+func (s *fileOutboxStore) append(channel string, r *outboxRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := fileutil.AppendFile(s.path(channel), append(b, '\n')); err != nil {
+		return err
+	}
+	s.lines[channel]++
+	return nil
+}
+
+// compact rewrites the file of channel with its remaining entries once most
+// of its lines are outdated, s.mu must be held.
+func (s *fileOutboxStore) compact(channel string) {
+	entries := s.channels[channel]
+	if s.lines[channel] <= 2*len(entries)+outboxCompactLines {
+		return
+	}
+
+	var b []byte
+	for seq, data := range entries {
+		line, err := json.Marshal(&outboxRecord{Seq: seq, Data: data})
+		if err != nil {
+			log.Printf("actor: compact outbox %s failed: %v\n", channel, err)
+			return
+		}
+		b = append(append(b, line...), '\n')
+	}
+	if err := fileutil.WriteFile(s.path(channel), b); err != nil {
+		log.Printf("actor: compact outbox %s failed: %v\n", channel, err)
+		return
+	}
+	s.lines[channel] = len(entries)
+}
+
+func (s *fileOutboxStore) Append(channel string, e OutboxEntry) error {
+	m, ok := e.Message.(proto.Message)
+	if !ok {
+		return fmt.Errorf("outbox: %T is not a proto message", e.Message)
+	}
+	data, err := remote.Marshal(m)
+	if err != nil {
+		return err
+	}
+	b, err := proto.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.entries(channel)
+	if err != nil {
+		return err
+	}
+	if err := s.append(channel, &outboxRecord{Seq: e.Seq, Data: b}); err != nil {
+		return err
+	}
+	entries[e.Seq] = b
+	return nil
+}
+
+func (s *fileOutboxStore) Remove(channel string, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.entries(channel)
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[seq]; !ok {
+		return nil
+	}
+	if err := s.append(channel, &outboxRecord{Seq: seq, Removed: true}); err != nil {
+		return err
+	}
+	delete(entries, seq)
+	s.compact(channel)
+	return nil
+}
+
+func (s *fileOutboxStore) Load(channel string) ([]OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.entries(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]OutboxEntry, 0, len(entries))
+	for seq, b := range entries {
+		data := &anypb.Any{}
+		if err := proto.Unmarshal(b, data); err != nil {
+			return nil, err
+		}
+		message, err := remote.Unmarshal(data)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, OutboxEntry{Seq: seq, Message: message})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Seq < results[j].Seq })
+	return results, nil
+}
+
+func (s *fileOutboxStore) seqPath(channel string) string {
+	return filepath.Join(s.dir, url.PathEscape(channel)+".seq")
+}
+
+func (s *fileOutboxStore) NextSeq(channel string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq, err := s.seq(channel)
+	if err != nil {
+		return 0, err
+	}
+	return seq + 1, nil
+}
+
+// seq returns the highest sequence number of channel, reading its file the
+// first time, s.mu must be held.
+func (s *fileOutboxStore) seq(channel string) (uint64, error) {
+	if seq, ok := s.seqs[channel]; ok {
+		return seq, nil
+	}
+
+	var seq uint64
+	b, err := os.ReadFile(s.seqPath(channel))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if len(b) > 0 {
+		if seq, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	s.seqs[channel] = seq
+	return seq, nil
+}
+
+func (s *fileOutboxStore) SetSeq(channel string, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, err := s.seq(channel)
+	if err != nil {
+		return err
+	}
+	if seq <= last {
+		return nil
+	}
+	if err := fileutil.WriteFile(s.seqPath(channel), []byte(strconv.FormatUint(seq, 10))); err != nil {
+		return err
+	}
+	s.seqs[channel] = seq
+	return nil
+}
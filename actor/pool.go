@@ -0,0 +1,302 @@
+package actor
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+const DefaultPoolResizeInterval = time.Second
+
+// PoolResized is sent to the PoolResizeNotify subscribers of a pool router
+// whenever the number of its routees changes.
+type PoolResized struct {
+	Router PID
+	From   int
+	To     int
+}
+
+// PoolStats is the load of a pool router over the last resize interval.
+type PoolStats struct {
+	Size int
+	// Mailbox is the number of messages queued by all the routees.
+	Mailbox int
+	// Routed is the number of messages routed during Interval.
+	Routed   int
+	Interval time.Duration
+}
+
+// PoolResizer returns the number of routees a pool router should have, the
+// result is bounded by the min and max of PoolResize.
+type PoolResizer interface {
+	Resize(stats PoolStats) int
+}
+
+type PoolResizerFunc func(stats PoolStats) int
+
+func (f PoolResizerFunc) Resize(stats PoolStats) int {
+	return f(stats)
+}
+
+// MailboxResizer adds a routee when the routees have more than upper messages
+// queued on average, and removes one when they have less than lower.
+func MailboxResizer(upper float64, lower float64) PoolResizer {
+	return PoolResizerFunc(func(stats PoolStats) int {
+		if stats.Size == 0 {
+			return 1
+		}
+		avg := float64(stats.Mailbox) / float64(stats.Size)
+		switch {
+		case avg > upper:
+			return stats.Size + 1
+		case avg < lower:
+			return stats.Size - 1
+		}
+		return stats.Size
+	})
+}
+
+// ThroughputResizer sizes the pool so that each routee handles about
+// perRoutee messages per second.
+func ThroughputResizer(perRoutee float64) PoolResizer {
+	return PoolResizerFunc(func(stats PoolStats) int {
+		if stats.Interval <= 0 || perRoutee <= 0 {
+			return stats.Size
+		}
+		rate := float64(stats.Routed) / stats.Interval.Seconds()
+		return int(math.Ceil(rate / perRoutee))
+	})
+}
+
+type poolOptions struct {
+	min           int
+	max           int
+	resizer       PoolResizer
+	interval      time.Duration
+	spawnOpts     []SpawnOption
+	notify        []PID
+	backoff       func(restart int) time.Duration
+	maxRestarts   int
+	restartWindow time.Duration
+}
+
+type PoolOption func(opts *poolOptions)
+
+// PoolResize lets the pool grow and shrink between min and max routees as
+// decided by resizer every resize interval.
+func PoolResize(min int, max int, resizer PoolResizer) PoolOption {
+	return func(opts *poolOptions) {
+		opts.min = min
+		opts.max = max
+		opts.resizer = resizer
+	}
+}
+
+func PoolResizeInterval(interval time.Duration) PoolOption {
+	return func(opts *poolOptions) {
+		opts.interval = interval
+	}
+}
+
+// PoolSpawnOptions sets the options the routees are spawned with, the routees
+// must not be given a Name.
+func PoolSpawnOptions(opt ...SpawnOption) PoolOption {
+	return func(opts *poolOptions) {
+		opts.spawnOpts = append(opts.spawnOpts, opt...)
+	}
+}
+
+// PoolRestartBackoff sets the delay before a routee that died, or failed to
+// spawn, is replaced, given the number of restarts within the restart window.
+// Defaults to an exponential backoff from 100ms up to 10s.
+func PoolRestartBackoff(backoff func(restart int) time.Duration) PoolOption {
+	return func(opts *poolOptions) {
+		opts.backoff = backoff
+	}
+}
+
+// PoolMaxRestarts stops the pool router once its routees have been restarted
+// more than n times within window, 10 times a minute by default. A
+// non-positive n restarts them forever.
+func PoolMaxRestarts(n int, window time.Duration) PoolOption {
+	return func(opts *poolOptions) {
+		opts.maxRestarts = n
+		opts.restartWindow = window
+	}
+}
+
+// PoolResizeNotify sends *PoolResized to pids when the pool is resized.
+func PoolResizeNotify(pids ...PID) PoolOption {
+	return func(opts *poolOptions) {
+		opts.notify = append(opts.notify, pids...)
+	}
+}
+
+type poolResize struct{}
+
+type poolRefill struct{}
+
+type routeeTerminated struct {
+	pid PID
+}
+
+type poolRouter struct {
+	router
+	opts     poolOptions
+	producer func() Actor
+	size     int
+	children map[PID]Process
+	routed   int
+	resized  time.Time
+	stopping bool
+	// restarts are the times routees were restarted within the restart
+	// window.
+	restarts []time.Time
+}
+
+// NewPoolRouter returns an actor that spawns size routees with producer as its
+// children and routes the messages it receives to them with strategy. A
+// routee that dies is replaced by a new one after PoolRestartBackoff, and the
+// router stops if they die too often, see PoolMaxRestarts. When the pool
+// shrinks, the routees that are removed are stopped and may drop the messages
+// still queued in their mailbox.
+func NewPoolRouter(strategy RouterStrategy, size int, producer func() Actor, opt ...PoolOption) Actor {
+	opts := poolOptions{
+		min:           size,
+		max:           size,
+		interval:      DefaultPoolResizeInterval,
+		backoff:       ExponentialBackoff(time.Millisecond*100, time.Second*10),
+		maxRestarts:   10,
+		restartWindow: time.Minute,
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &poolRouter{
+		router:   router{strategy: strategy},
+		opts:     opts,
+		producer: producer,
+		size:     clamp(size, opts.min, opts.max),
+		children: make(map[PID]Process),
+	}
+}
+
+func (r *poolRouter) Receive(c Context) {
+	switch msg := c.Message().(type) {
+	case *Started:
+		r.resized = time.Now()
+		r.fill(c)
+		if r.opts.resizer != nil {
+			c.Timers().StartPeriodicTimer("resize", &poolResize{}, r.opts.interval)
+		}
+	case *Stopping:
+		r.stopping = true
+	case *poolResize:
+		r.resize(c)
+	case *routeeTerminated:
+		if _, ok := r.children[msg.pid]; !ok {
+			return
+		}
+		delete(r.children, msg.pid)
+		r.removeRoutee(msg.pid)
+		if !r.stopping {
+			r.restart(c)
+		}
+	case *poolRefill:
+		if !r.stopping {
+			r.fill(c)
+		}
+	default:
+		if r.receive(c) {
+			r.routed++
+		}
+	}
+}
+
+// fill spawns routees until the pool has its target size.
+func (r *poolRouter) fill(c Context) {
+	for len(r.children) < r.size {
+		child, err := c.SpawnActor(r.producer(), r.opts.spawnOpts...)
+		if err != nil {
+			log.Printf("actor: pool %v spawn routee failed: %v\n", c.Self(), err)
+			r.restart(c)
+			return
+		}
+		r.children[child.Self()] = child
+		r.addRoutee(child.Self())
+		go r.watch(c, child)
+	}
+}
+
+// restart refills the pool after the backoff of the restarts within the
+// window, or stops the router if there have been too many.
+func (r *poolRouter) restart(c Context) {
+	now := time.Now()
+	restarts := r.restarts[:0]
+	for _, t := range r.restarts {
+		if now.Sub(t) < r.opts.restartWindow {
+			restarts = append(restarts, t)
+		}
+	}
+	r.restarts = append(restarts, now)
+
+	if r.opts.maxRestarts > 0 && len(r.restarts) > r.opts.maxRestarts {
+		log.Printf("actor: pool %v routees restarted more than %d times in %v, stopping\n", c.Self(), r.opts.maxRestarts, r.opts.restartWindow)
+		r.stopping = true
+		c.Stop()
+		return
+	}
+	c.Timers().StartTimer("refill", &poolRefill{}, r.opts.backoff(len(r.restarts)))
+}
+
+func (r *poolRouter) watch(c Context, child Process) {
+	select {
+	case <-child.Context().Done():
+		c.SendCtx(c.Context(), c.Self(), &routeeTerminated{pid: child.Self()})
+	case <-c.Context().Done():
+	}
+}
+
+func (r *poolRouter) resize(c Context) {
+	now := time.Now()
+	stats := PoolStats{
+		Size:     len(r.children),
+		Routed:   r.routed,
+		Interval: now.Sub(r.resized),
+	}
+	for _, child := range r.children {
+		stats.Mailbox += len(child.ProcessChannels().Mailbox)
+	}
+	r.routed, r.resized = 0, now
+
+	size := clamp(r.opts.resizer.Resize(stats), r.opts.min, r.opts.max)
+	if size == r.size {
+		return
+	}
+	from := r.size
+	r.size = size
+
+	for pid, child := range r.children {
+		if len(r.children) <= r.size {
+			break
+		}
+		delete(r.children, pid)
+		r.removeRoutee(pid)
+		child.Stop()
+	}
+	r.fill(c)
+
+	for _, pid := range r.opts.notify {
+		c.Send(pid, &PoolResized{Router: c.Self(), From: from, To: r.size})
+	}
+}
+
+func clamp(n int, min int, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -12,20 +12,23 @@ type Process interface {
 	SpawnActor(actor Actor, opt ...SpawnOption) (Process, error)
 	CallCtx(ctx context.Context, to PID, message interface{}) *Future
 	Call(to PID, message interface{}) *Future
+	CallWithRetry(ctx context.Context, to PID, message interface{}, policy *RetryPolicy) (interface{}, error)
+	OpenStream(ctx context.Context, to PID, message interface{}, opt ...StreamOption) (*Stream, error)
+	OpenReliableChannel(to PID, opt ...ReliableOption) (*ReliableChannel, error)
+	Subscribe(predicate func(event interface{}) bool) (*Subscription, error)
+	Publish(event interface{})
 }
 
 type actorProcess struct {
 	core.Process
+	// behavior is set for the process of the actor handling the message, the
+	// behavior of the core process may wrap it.
+	behavior *actorBehavior
 }
 
 func (p *actorProcess) SpawnActor(actor Actor, opt ...SpawnOption) (Process, error) {
-	opts := &core.SpawnOptions{}
-	for _, o := range opt {
-		o(opts)
-	}
-	process, err := p.Process.Spawn(&actorBehavior{
-		actor: actor,
-	}, opts)
+	opts := newSpawnOptions(opt)
+	process, err := p.Process.Spawn(newActorBehavior(actor, opts), &opts.SpawnOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -40,6 +43,10 @@ func (p *actorProcess) Call(to PID, message interface{}) *Future {
 }
 
 func (p *actorProcess) CallCtx(ctx context.Context, to PID, message interface{}) *Future {
+	return p.call(ctx, to, message, nil)
+}
+
+func (p *actorProcess) call(ctx context.Context, to PID, message interface{}, header map[string]string) *Future {
 	var timeout time.Duration
 	if deadline, ok := ctx.Deadline(); ok {
 		timeout = time.Until(deadline)
@@ -49,7 +56,17 @@ func (p *actorProcess) CallCtx(ctx context.Context, to PID, message interface{})
 		panic(err)
 	}
 
-	if err := future.Send(to, message); err != nil {
+	request := core.Message{
+		From:   future.Self(),
+		Flag:   core.MessageFlagRequest,
+		Data:   message,
+		SentAt: time.Now(),
+		Header: header,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		request.Deadline = deadline
+	}
+	if err := future.SendCtx(ctx, to, request); err != nil {
 		future.SetErr(err)
 	}
 	return future
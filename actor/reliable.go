@@ -0,0 +1,456 @@
+package actor
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/core"
+	"github.com/google/uuid"
+)
+
+const (
+	// HeaderReliableChannel and HeaderReliableSeq identify a message sent
+	// through a ReliableChannel, HeaderReliableLow is the lowest sequence
+	// number the channel has not seen acknowledged yet.
+	HeaderReliableChannel = "reliable-channel"
+	HeaderReliableSeq     = "reliable-seq"
+	HeaderReliableLow     = "reliable-low"
+
+	DefaultRedeliverAfter = time.Second * 5
+	DefaultMaxPending     = 1000
+)
+
+var (
+	ErrReliableChannelClosed  = errors.New("reliable channel closed")
+	ErrReliableOutboxRequired = errors.New("reliable channel id requires an outbox")
+)
+
+type reliableOptions struct {
+	id             string
+	redeliverAfter time.Duration
+	maxPending     int
+	outbox         OutboxStore
+}
+
+type ReliableOption func(opts *reliableOptions)
+
+// ReliableChannelID names the channel, it requires ReliableOutbox. A channel
+// reopened with the same id and outbox redelivers the messages left
+// unacknowledged by the previous one and goes on from its last sequence
+// number, and the receiver keeps discarding the duplicates.
+func ReliableChannelID(id string) ReliableOption {
+	return func(opts *reliableOptions) {
+		opts.id = id
+	}
+}
+
+// RedeliverAfter sets how long the channel waits for an ack before sending a
+// message again.
+func RedeliverAfter(d time.Duration) ReliableOption {
+	return func(opts *reliableOptions) {
+		opts.redeliverAfter = d
+	}
+}
+
+// MaxPending sets how many messages may wait for an ack, Send blocks beyond.
+func MaxPending(n int) ReliableOption {
+	return func(opts *reliableOptions) {
+		opts.maxPending = n
+	}
+}
+
+// ReliableOutbox keeps the unacknowledged messages in store instead of
+// memory.
+func ReliableOutbox(store OutboxStore) ReliableOption {
+	return func(opts *reliableOptions) {
+		opts.outbox = store
+	}
+}
+
+// ReliableChannel delivers messages to a single receiver at least once: every
+// message is kept in an outbox and sent again until the receiver acknowledges
+// it, which it does after Receive has returned. The receiver discards the
+// duplicates it has already handled since it started, or across restarts with
+// ReliableInbox. A message may still be handled twice if the receiver stops
+// between handling it and recording it.
+//
+// A router does not acknowledge the messages it routes, its routees do once
+// they have handled them. A message redelivered through a router may reach
+// another routee than the first time and be handled twice.
+//
+// The channel is a child process of the process that opened it.
+type ReliableChannel struct {
+	core.Process
+	opts reliableOptions
+	to   PID
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]*reliablePending
+	space   chan struct{}
+	closed  bool
+}
+
+type reliablePending struct {
+	message interface{}
+	sentAt  time.Time
+}
+
+func (p *actorProcess) OpenReliableChannel(to PID, opt ...ReliableOption) (*ReliableChannel, error) {
+	opts := reliableOptions{
+		redeliverAfter: DefaultRedeliverAfter,
+		maxPending:     DefaultMaxPending,
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.id == "" {
+		opts.id = uuid.New().String()
+	} else if opts.outbox == nil {
+		// A memory outbox would start the channel over at the sequence
+		// numbers the receiver has already handled.
+		return nil, ErrReliableOutboxRequired
+	}
+	if opts.outbox == nil {
+		opts.outbox = NewMemoryOutboxStore()
+	}
+
+	entries, err := opts.outbox.Load(opts.id)
+	if err != nil {
+		return nil, err
+	}
+	next, err := opts.outbox.NextSeq(opts.id)
+	if err != nil {
+		return nil, err
+	}
+	ch := &ReliableChannel{
+		opts:    opts,
+		to:      to,
+		seq:     next - 1,
+		pending: make(map[uint64]*reliablePending),
+		space:   make(chan struct{}, 1),
+	}
+	for _, e := range entries {
+		// Zero sentAt, the loaded messages are redelivered right away.
+		ch.pending[e.Seq] = &reliablePending{message: e.Message}
+		if e.Seq > ch.seq {
+			ch.seq = e.Seq
+		}
+	}
+
+	process, err := p.Spawn(ch, &core.SpawnOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ch.Process = process
+	return ch, nil
+}
+
+// ID returns the id of the channel, carried by its messages in
+// HeaderReliableChannel.
+func (ch *ReliableChannel) ID() string {
+	return ch.opts.id
+}
+
+// Send stores message in the outbox and sends it. It returns once the message
+// is stored, the send itself is retried until the receiver acknowledges it.
+func (ch *ReliableChannel) Send(message interface{}) error {
+	ch.mu.Lock()
+	for len(ch.pending) >= ch.opts.maxPending && !ch.closed {
+		ch.mu.Unlock()
+		select {
+		case <-ch.space:
+		case <-ch.Context().Done():
+			return ErrReliableChannelClosed
+		}
+		ch.mu.Lock()
+	}
+	if ch.closed {
+		ch.mu.Unlock()
+		return ErrReliableChannelClosed
+	}
+
+	seq := ch.seq + 1
+	// Recorded before the entry, a crash in between only skips seq.
+	if err := ch.opts.outbox.SetSeq(ch.opts.id, seq); err != nil {
+		ch.mu.Unlock()
+		return err
+	}
+	if err := ch.opts.outbox.Append(ch.opts.id, OutboxEntry{Seq: seq, Message: message}); err != nil {
+		ch.mu.Unlock()
+		return err
+	}
+	ch.seq = seq
+	ch.pending[seq] = &reliablePending{message: message, sentAt: time.Now()}
+	low := ch.low()
+	ch.mu.Unlock()
+
+	ch.send(ch.Process, seq, low, message)
+	return nil
+}
+
+// Pending returns how many messages wait for an ack.
+func (ch *ReliableChannel) Pending() int {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	return len(ch.pending)
+}
+
+// Close stops redelivering, the messages left in a durable outbox are sent by
+// the next channel opened with the same id.
+func (ch *ReliableChannel) Close() {
+	ch.Kill()
+}
+
+// low returns the lowest pending sequence number, ch.mu must be held.
+func (ch *ReliableChannel) low() uint64 {
+	low := ch.seq + 1
+	for seq := range ch.pending {
+		if seq < low {
+			low = seq
+		}
+	}
+	return low
+}
+
+func (ch *ReliableChannel) send(process core.Process, seq uint64, low uint64, message interface{}) {
+	// A failed send is retried by the redelivery of the channel.
+	process.Send(ch.to, core.Message{
+		From: process.Self(),
+		Data: message,
+		Header: map[string]string{
+			HeaderReliableChannel: ch.opts.id,
+			HeaderReliableSeq:     strconv.FormatUint(seq, 10),
+			HeaderReliableLow:     strconv.FormatUint(low, 10),
+		},
+	})
+}
+
+func (ch *ReliableChannel) ProcessLoop(process core.Process) error {
+	defer func() {
+		ch.mu.Lock()
+		ch.closed = true
+		ch.mu.Unlock()
+	}()
+
+	interval := ch.opts.redeliverAfter / 2
+	if interval <= 0 {
+		interval = time.Millisecond * 100
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ch.redeliver(process)
+	channels := process.ProcessChannels()
+	for {
+		select {
+		case msg := <-channels.Mailbox:
+			if ack, ok := msg.Data.(*ReliableAck); ok && ack.Channel == ch.opts.id {
+				ch.ack(ack.Seq)
+			}
+		case <-ticker.C:
+			ch.redeliver(process)
+		case <-channels.Exit:
+			return nil
+		case <-process.Context().Done():
+			return process.Context().Err()
+		}
+	}
+}
+
+func (ch *ReliableChannel) ack(seq uint64) {
+	ch.mu.Lock()
+	_, ok := ch.pending[seq]
+	delete(ch.pending, seq)
+	ch.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	ch.opts.outbox.Remove(ch.opts.id, seq)
+	select {
+	case ch.space <- struct{}{}:
+	default:
+	}
+}
+
+func (ch *ReliableChannel) redeliver(process core.Process) {
+	type resend struct {
+		seq     uint64
+		message interface{}
+	}
+
+	now := time.Now()
+	var resends []resend
+	ch.mu.Lock()
+	low := ch.low()
+	for seq, pending := range ch.pending {
+		if now.Sub(pending.sentAt) >= ch.opts.redeliverAfter {
+			pending.sentAt = now
+			resends = append(resends, resend{seq: seq, message: pending.message})
+		}
+	}
+	ch.mu.Unlock()
+
+	for _, r := range resends {
+		ch.send(process, r.seq, low, r.message)
+	}
+}
+
+// reliableReceiver discards the messages of reliable channels that have
+// already been handled and acknowledges the handled ones. With a store, the
+// windows are saved before the acks and loaded again when the actor restarts.
+type reliableReceiver struct {
+	store    InboxStore
+	channels map[string]*reliableWindow
+}
+
+// reliableWindow holds the handled sequence numbers of a channel: all of them
+// below next, and the ones in seen that have been handled out of order. A
+// dirty window has failed to be saved.
+type reliableWindow struct {
+	next  uint64
+	seen  map[uint64]struct{}
+	dirty bool
+}
+
+// reliableForwarder is implemented by the actors that pass the messages of
+// reliable channels on, the receivers they pass them to acknowledge them.
+type reliableForwarder interface {
+	forwardsReliable()
+}
+
+// advance moves next past low and the contiguous handled sequence numbers.
+func (w *reliableWindow) advance(low uint64) {
+	if low > w.next {
+		for seq := range w.seen {
+			if seq < low {
+				delete(w.seen, seq)
+			}
+		}
+		w.next = low
+	}
+	for {
+		if _, ok := w.seen[w.next]; !ok {
+			break
+		}
+		delete(w.seen, w.next)
+		w.next++
+	}
+}
+
+func reliableHeader(message core.Message) (id string, seq uint64, low uint64, ok bool) {
+	id = message.Header[HeaderReliableChannel]
+	if id == "" {
+		return "", 0, 0, false
+	}
+	seq, err := strconv.ParseUint(message.Header[HeaderReliableSeq], 10, 64)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	low, err = strconv.ParseUint(message.Header[HeaderReliableLow], 10, 64)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	return id, seq, low, true
+}
+
+// duplicate reports whether the message has already been handled, a
+// duplicate is acknowledged again since the previous ack may have been lost.
+func (r *reliableReceiver) duplicate(process core.Process, message core.Message) bool {
+	id, seq, low, ok := reliableHeader(message)
+	if !ok {
+		return false
+	}
+
+	next := low
+	w, ok := r.channels[id]
+	if ok && w.next > next {
+		next = w.next
+	}
+	if seq >= next {
+		if !ok {
+			return false
+		}
+		if _, seen := w.seen[seq]; !seen {
+			return false
+		}
+	}
+	if ok && w.dirty && !r.save(process, id, w) {
+		return true
+	}
+	r.sendAck(process, message.From, id, seq)
+	return true
+}
+
+func (r *reliableReceiver) ack(process core.Process, message core.Message) {
+	id, seq, low, ok := reliableHeader(message)
+	if !ok {
+		return
+	}
+
+	if r.channels == nil {
+		r.channels = make(map[string]*reliableWindow)
+	}
+	w, ok := r.channels[id]
+	if !ok {
+		w = &reliableWindow{next: low, seen: make(map[uint64]struct{})}
+		r.channels[id] = w
+	}
+	w.seen[seq] = struct{}{}
+	w.advance(low)
+	if !r.save(process, id, w) {
+		// Not acknowledged, the redelivery saves it again.
+		return
+	}
+	r.sendAck(process, message.From, id, seq)
+}
+
+// load reads the windows saved by the previous run of the actor.
+func (r *reliableReceiver) load(process core.Process) error {
+	if r.store == nil {
+		return nil
+	}
+	windows, err := r.store.Load(process.Self().ID)
+	if err != nil {
+		return err
+	}
+	r.channels = make(map[string]*reliableWindow, len(windows))
+	for id, w := range windows {
+		rw := &reliableWindow{next: w.Next, seen: make(map[uint64]struct{}, len(w.Seen))}
+		for _, seq := range w.Seen {
+			rw.seen[seq] = struct{}{}
+		}
+		r.channels[id] = rw
+	}
+	return nil
+}
+
+func (r *reliableReceiver) save(process core.Process, id string, w *reliableWindow) bool {
+	if r.store == nil {
+		return true
+	}
+	window := InboxWindow{Next: w.next, Seen: make([]uint64, 0, len(w.seen))}
+	for seq := range w.seen {
+		window.Seen = append(window.Seen, seq)
+	}
+	sort.Slice(window.Seen, func(i, j int) bool { return window.Seen[i] < window.Seen[j] })
+	if err := r.store.Save(process.Self().ID, id, window); err != nil {
+		if !w.dirty {
+			log.Printf("actor: %v save reliable window %s failed: %v\n", process.Self(), id, err)
+		}
+		w.dirty = true
+		return false
+	}
+	w.dirty = false
+	return true
+}
+
+func (r *reliableReceiver) sendAck(process core.Process, to PID, id string, seq uint64) {
+	process.Send(to, &ReliableAck{Channel: id, Seq: seq})
+}
@@ -0,0 +1,100 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/geniuscirno/go-actor/cluster"
+	"github.com/geniuscirno/go-actor/core"
+	"github.com/google/uuid"
+)
+
+const HeaderIdempotencyKey = core.HeaderIdempotencyKey
+
+type RetryPolicy struct {
+	// Attempts is the maximum number of calls, including the first one.
+	Attempts int
+	// AttemptTimeout bounds every single call, the overall deadline is still
+	// the one of the context passed to CallWithRetry.
+	AttemptTimeout time.Duration
+	// Backoff returns the delay before the given retry, starting from 1.
+	Backoff func(retry int) time.Duration
+	// Retryable reports whether a failed call should be retried.
+	Retryable func(err error) bool
+}
+
+var DefaultRetryPolicy = &RetryPolicy{
+	Attempts:       3,
+	AttemptTimeout: time.Second * 5,
+	Backoff:        ExponentialBackoff(time.Millisecond*100, time.Second*2),
+	Retryable:      IsRetryable,
+}
+
+func ExponentialBackoff(base time.Duration, max time.Duration) func(retry int) time.Duration {
+	return func(retry int) time.Duration {
+		d := base
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// IsRetryable reports whether err is caused by the target being unreachable
+// or slow rather than by the target actor rejecting the request.
+func IsRetryable(err error) bool {
+	return errors.Is(err, core.ErrTimeout) ||
+		errors.Is(err, core.ErrProcessNotFound) ||
+		errors.Is(err, cluster.ErrNoNode) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// CallWithRetry calls to until it replies, the policy gives up or ctx is done.
+// Every attempt carries the same idempotency key header, so a receiver using
+// IdempotencyMiddleware executes the request at most once within its window.
+func (p *actorProcess) CallWithRetry(ctx context.Context, to PID, message interface{}, policy *RetryPolicy) (interface{}, error) {
+	if policy == nil {
+		policy = DefaultRetryPolicy
+	}
+	attemptTimeout := policy.AttemptTimeout
+	if attemptTimeout == 0 {
+		attemptTimeout = time.Second * 5
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	header := map[string]string{HeaderIdempotencyKey: uuid.New().String()}
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		result, err := p.call(attemptCtx, to, message, header).Result()
+		cancel()
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+
+		if attempt >= policy.Attempts || !retryable(err) {
+			return nil, lastErr
+		}
+
+		var backoff time.Duration
+		if policy.Backoff != nil {
+			backoff = policy.Backoff(attempt)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, lastErr
+		case <-timer.C:
+		}
+	}
+}
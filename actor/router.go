@@ -0,0 +1,263 @@
+package actor
+
+import (
+	"log"
+	"math"
+	"math/rand"
+
+	"github.com/geniuscirno/go-actor/core"
+	"github.com/geniuscirno/go-actor/hashring"
+)
+
+// AddRoutee adds a routee to a router.
+type AddRoutee struct {
+	PID PID
+}
+
+// RemoveRoutee removes a routee from a router.
+type RemoveRoutee struct {
+	PID PID
+}
+
+// GetRoutees asks a router for its routees, it replies with *Routees.
+type GetRoutees struct{}
+
+type Routees struct {
+	PIDs []PID
+}
+
+// Broadcast sends Message to every routee whatever the strategy of the router,
+// with the sender of the Broadcast.
+type Broadcast struct {
+	Message interface{}
+}
+
+// Hasher is implemented by messages routed by ConsistentHashStrategy.
+type Hasher interface {
+	HashKey() string
+}
+
+// RouterStrategy picks the routees of a message. It is only used from the
+// router actor, so it does not need to be safe for concurrent use.
+type RouterStrategy interface {
+	UpdateRoutees(routees []PID)
+	RouteTo(c Context, message interface{}) []PID
+}
+
+type roundRobinStrategy struct {
+	routees []PID
+	next    int
+}
+
+func RoundRobinStrategy() RouterStrategy {
+	return &roundRobinStrategy{}
+}
+
+func (s *roundRobinStrategy) UpdateRoutees(routees []PID) {
+	s.routees = routees
+}
+
+func (s *roundRobinStrategy) RouteTo(c Context, message interface{}) []PID {
+	if len(s.routees) == 0 {
+		return nil
+	}
+	pid := s.routees[s.next%len(s.routees)]
+	s.next = (s.next + 1) % len(s.routees)
+	return []PID{pid}
+}
+
+type randomStrategy struct {
+	routees []PID
+}
+
+func RandomStrategy() RouterStrategy {
+	return &randomStrategy{}
+}
+
+func (s *randomStrategy) UpdateRoutees(routees []PID) {
+	s.routees = routees
+}
+
+func (s *randomStrategy) RouteTo(c Context, message interface{}) []PID {
+	if len(s.routees) == 0 {
+		return nil
+	}
+	return []PID{s.routees[rand.Intn(len(s.routees))]}
+}
+
+type broadcastStrategy struct {
+	routees []PID
+}
+
+func BroadcastStrategy() RouterStrategy {
+	return &broadcastStrategy{}
+}
+
+func (s *broadcastStrategy) UpdateRoutees(routees []PID) {
+	s.routees = routees
+}
+
+func (s *broadcastStrategy) RouteTo(c Context, message interface{}) []PID {
+	return s.routees
+}
+
+type smallestMailboxStrategy struct {
+	routees []PID
+}
+
+// SmallestMailboxStrategy routes to the routee with the fewest queued
+// messages. Routees on other nodes are only picked if no local routee is
+// alive, since their mailbox size is unknown.
+func SmallestMailboxStrategy() RouterStrategy {
+	return &smallestMailboxStrategy{}
+}
+
+func (s *smallestMailboxStrategy) UpdateRoutees(routees []PID) {
+	s.routees = routees
+}
+
+func (s *smallestMailboxStrategy) RouteTo(c Context, message interface{}) []PID {
+	var (
+		target PID
+		found  bool
+		min    = math.MaxInt
+	)
+	for _, pid := range s.routees {
+		size := math.MaxInt
+		if p, err := c.Node().Lookup(pid); err == nil {
+			size = len(p.ProcessChannels().Mailbox)
+		}
+		if !found || size < min {
+			target, min, found = pid, size, true
+		}
+		if size == 0 {
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+	return []PID{target}
+}
+
+type consistentHashStrategy struct {
+	replicas int
+	routees  map[string]PID
+	ring     *hashring.Ring
+}
+
+// ConsistentHashStrategy routes messages with the same Hasher key to the same
+// routee, messages that are not a Hasher are dropped.
+func ConsistentHashStrategy(replicas int) RouterStrategy {
+	return &consistentHashStrategy{replicas: replicas, ring: hashring.New(replicas)}
+}
+
+func (s *consistentHashStrategy) UpdateRoutees(routees []PID) {
+	s.routees = make(map[string]PID, len(routees))
+	members := make([]string, 0, len(routees))
+	for _, pid := range routees {
+		s.routees[pid.String()] = pid
+		members = append(members, pid.String())
+	}
+	s.ring = hashring.New(s.replicas, members...)
+}
+
+func (s *consistentHashStrategy) RouteTo(c Context, message interface{}) []PID {
+	h, ok := message.(Hasher)
+	if !ok {
+		log.Printf("actor: router %v drop message %T without HashKey\n", c.Self(), message)
+		return nil
+	}
+	member, ok := s.ring.Get(h.HashKey())
+	if !ok {
+		return nil
+	}
+	return []PID{s.routees[member]}
+}
+
+type router struct {
+	strategy RouterStrategy
+	routees  []PID
+}
+
+func (r *router) setRoutees(routees []PID) {
+	r.routees = routees
+	r.strategy.UpdateRoutees(append([]PID(nil), routees...))
+}
+
+func (r *router) addRoutee(pid PID) {
+	for _, routee := range r.routees {
+		if routee == pid {
+			return
+		}
+	}
+	r.setRoutees(append(append([]PID(nil), r.routees...), pid))
+}
+
+func (r *router) removeRoutee(pid PID) {
+	routees := make([]PID, 0, len(r.routees))
+	for _, routee := range r.routees {
+		if routee != pid {
+			routees = append(routees, routee)
+		}
+	}
+	r.setRoutees(routees)
+}
+
+// forwardsReliable leaves the acks of reliable channels to the routees, which
+// send them once they have handled the messages.
+func (r *router) forwardsReliable() {}
+
+// receive handles management messages and routes any other message, it
+// reports false for lifecycle messages which the caller handles.
+func (r *router) receive(c Context) bool {
+	switch msg := c.Message().(type) {
+	case *Started, *Stopping, *Stopped:
+		return false
+	case *AddRoutee:
+		r.addRoutee(msg.PID)
+	case *RemoveRoutee:
+		r.removeRoutee(msg.PID)
+	case *GetRoutees:
+		c.Reply(&Routees{PIDs: append([]PID(nil), r.routees...)})
+	case *Broadcast:
+		for _, pid := range r.routees {
+			forwardData(c, pid, msg.Message)
+		}
+	default:
+		for _, pid := range r.strategy.RouteTo(c, msg) {
+			c.Forward(pid)
+		}
+	}
+	return true
+}
+
+// forwardData forwards the message of c to to with data in place of its data,
+// keeping its sender like Forward does.
+func forwardData(c Context, to PID, data interface{}) error {
+	if ac, ok := c.(*actorContext); ok {
+		if m, ok := ac.message.(core.Message); ok {
+			m.Data = data
+			return c.Send(to, m)
+		}
+	}
+	return c.Send(to, core.Message{From: c.From(), Data: data})
+}
+
+type groupRouter struct {
+	router
+}
+
+// NewGroupRouter returns an actor routing the messages it receives to routees
+// with strategy. Routed messages keep their sender, so routees reply to the
+// sender directly. The routees are not watched: a dead routee stays in the
+// group until it is removed with RemoveRoutee.
+func NewGroupRouter(strategy RouterStrategy, routees ...PID) Actor {
+	r := &groupRouter{router: router{strategy: strategy}}
+	r.setRoutees(append([]PID(nil), routees...))
+	return r
+}
+
+func (r *groupRouter) Receive(c Context) {
+	r.receive(c)
+}
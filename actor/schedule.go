@@ -1,39 +1,197 @@
 package actor
 
 import (
+	"context"
+	"sync"
 	"time"
+
+	"github.com/geniuscirno/go-actor/core"
 )
 
 type CancelFunc func()
 
+// TimerScheduler sends messages after a delay or periodically on behalf of a
+// process. All timers are owned by that process: they are cancelled when it
+// dies, and an actor cancels the timers of its own scheduler (Context.Timers)
+// as soon as it starts stopping.
+//
+// Keyed timers deliver the message to the owner itself. Their messages are
+// waited for in the owner's mailbox rather than dropped after a timeout, and a
+// message of a timer that has been cancelled or restarted in the meantime is
+// discarded even if it is already in the mailbox.
 type TimerScheduler struct {
 	process Process
+
+	mu     sync.Mutex
+	nextID int64
+	timers map[string]*timer
+	sends  map[int64]*timer
+	crons  map[string]*cronEntry
+}
+
+type timer struct {
+	id     int64
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// timerMessage wraps the message of a keyed timer, it is unwrapped by
+// actorBehavior if the timer is still the current one for its key.
+type timerMessage struct {
+	scheduler *TimerScheduler
+	key       string
+	id        int64
+	periodic  bool
+	message   interface{}
 }
 
 func NewTimerScheduler(process Process) *TimerScheduler {
-	return &TimerScheduler{process: process}
+	return &TimerScheduler{
+		process: process,
+		timers:  make(map[string]*timer),
+		sends:   make(map[int64]*timer),
+		crons:   make(map[string]*cronEntry),
+	}
 }
 
-func (s *TimerScheduler) SendOnce(to PID, message interface{}, delay time.Duration) CancelFunc {
-	t := time.AfterFunc(delay, func() {
-		s.process.Send(to, message)
-	})
-	return func() {
-		t.Stop()
+// StartTimer sends message to the owner once after delay, replacing any timer
+// with the same key.
+func (s *TimerScheduler) StartTimer(key string, message interface{}, delay time.Duration) {
+	s.startTimer(key, message, delay, 0)
+}
+
+// StartPeriodicTimer sends message to the owner every interval, replacing any
+// timer with the same key.
+func (s *TimerScheduler) StartPeriodicTimer(key string, message interface{}, interval time.Duration) {
+	s.startTimer(key, message, interval, interval)
+}
+
+func (s *TimerScheduler) startTimer(key string, message interface{}, delay time.Duration, interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.timers[key]; ok {
+		t.cancel()
+	}
+	s.nextID++
+	t := s.newTimer(s.nextID)
+	s.timers[key] = t
+
+	self := s.process.Self()
+	go s.run(t, self, &timerMessage{
+		scheduler: s,
+		key:       key,
+		id:        t.id,
+		periodic:  interval > 0,
+		message:   message,
+	}, delay, interval, nil)
+}
+
+func (s *TimerScheduler) CancelTimer(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.timers[key]; ok {
+		t.cancel()
+		delete(s.timers, key)
+	}
+}
+
+func (s *TimerScheduler) IsTimerActive(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.timers[key]
+	return ok
+}
+
+// CancelAll cancels every timer started by the scheduler.
+func (s *TimerScheduler) CancelAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, t := range s.timers {
+		t.cancel()
+		delete(s.timers, key)
+	}
+	for id, t := range s.sends {
+		t.cancel()
+		delete(s.sends, id)
+	}
+	for key, e := range s.crons {
+		e.cancel()
+		delete(s.crons, key)
+	}
+}
+
+// accept reports whether the message of a keyed timer should be handled,
+// a single-shot timer is done once its message has been accepted.
+func (s *TimerScheduler) accept(m *timerMessage) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.timers[m.key]
+	if !ok || t.id != m.id {
+		return false
+	}
+	if !m.periodic {
+		t.cancel()
+		delete(s.timers, m.key)
 	}
+	return true
+}
+
+func (s *TimerScheduler) SendOnce(to PID, message interface{}, delay time.Duration) CancelFunc {
+	return s.send(to, message, delay, 0)
 }
 
 func (s *TimerScheduler) SendRepeatedly(to PID, message interface{}, interval time.Duration) CancelFunc {
-	t := time.NewTicker(interval)
-	go func() {
-		for {
-			select {
-			case <-t.C:
-				s.process.Send(to, message)
-			}
+	return s.send(to, message, interval, interval)
+}
+
+func (s *TimerScheduler) send(to PID, message interface{}, delay time.Duration, interval time.Duration) CancelFunc {
+	s.mu.Lock()
+	s.nextID++
+	t := s.newTimer(s.nextID)
+	s.sends[t.id] = t
+	s.mu.Unlock()
+
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		t.cancel()
+		delete(s.sends, t.id)
+	}
+	go s.run(t, to, message, delay, interval, cancel)
+	return cancel
+}
+
+func (s *TimerScheduler) newTimer(id int64) *timer {
+	ctx, cancel := context.WithCancel(s.process.Context())
+	return &timer{id: id, ctx: ctx, cancel: cancel}
+}
+
+func (s *TimerScheduler) run(t *timer, to PID, message interface{}, delay time.Duration, interval time.Duration, done func()) {
+	if done != nil {
+		defer done()
+	}
+
+	tm := time.NewTimer(delay)
+	defer tm.Stop()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-tm.C:
+		}
+
+		// Waits for room in the mailbox rather than giving up after a timeout,
+		// the wait ends when the timer is cancelled or the owner dies.
+		s.process.SendCtx(t.ctx, to, core.Message{From: s.process.Self(), Data: message})
+		if interval == 0 {
+			return
 		}
-	}()
-	return func() {
-		t.Stop()
+		tm.Reset(interval)
 	}
 }
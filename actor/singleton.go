@@ -0,0 +1,33 @@
+package actor
+
+import (
+	"context"
+
+	"github.com/geniuscirno/go-actor/cluster/singleton"
+	"github.com/geniuscirno/go-actor/core"
+)
+
+// Singleton is the handle of an actor running on a single node of the
+// cluster, the messages are sent through the proxy of this node.
+type Singleton struct {
+	*singleton.Manager
+	root Process
+}
+
+// NewSingleton returns the handle of the singleton name, producer returns the
+// actor every time it is spawned on this node. The singleton runs once the
+// Manager is started.
+func NewSingleton(node *Node, name string, producer func() Actor, election singleton.Election, opt ...singleton.Option) *Singleton {
+	m := singleton.New(node.Node, name, func() core.ProcessBehavior {
+		return newActorBehavior(producer(), newSpawnOptions(nil))
+	}, election, opt...)
+	return &Singleton{Manager: m, root: node.Root}
+}
+
+func (s *Singleton) Send(ctx context.Context, message interface{}) error {
+	return s.root.SendCtx(ctx, s.PID(), message)
+}
+
+func (s *Singleton) Call(ctx context.Context, message interface{}) *Future {
+	return s.root.CallCtx(ctx, s.PID(), message)
+}
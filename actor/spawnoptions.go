@@ -1,11 +1,63 @@
 package actor
 
-import "github.com/geniuscirno/go-actor/core"
+import (
+	"github.com/geniuscirno/go-actor/cluster"
+	"github.com/geniuscirno/go-actor/core"
+)
 
-type SpawnOption func(opts *core.SpawnOptions)
+type SpawnOptions struct {
+	core.SpawnOptions
+	RequestMetrics     *RequestMetrics
+	ReceiverMiddleware []ReceiverMiddleware
+	Constraints        []cluster.Constraint
+	ReliableInbox      InboxStore
+}
+
+type SpawnOption func(opts *SpawnOptions)
+
+func newSpawnOptions(opt []SpawnOption) *SpawnOptions {
+	opts := &SpawnOptions{RequestMetrics: DefaultRequestMetrics}
+	for _, o := range opt {
+		o(opts)
+	}
+	return opts
+}
 
 func Name(name string) SpawnOption {
-	return func(opts *core.SpawnOptions) {
+	return func(opts *SpawnOptions) {
 		opts.Name = name
 	}
 }
+
+// WithRequestMetrics records the age of requests handled by the actor in m
+// instead of DefaultRequestMetrics.
+func WithRequestMetrics(m *RequestMetrics) SpawnOption {
+	return func(opts *SpawnOptions) {
+		opts.RequestMetrics = m
+	}
+}
+
+// WithReceiverMiddleware appends middlewares to the actor, the first one is
+// the outermost.
+func WithReceiverMiddleware(middleware ...ReceiverMiddleware) SpawnOption {
+	return func(opts *SpawnOptions) {
+		opts.ReceiverMiddleware = append(opts.ReceiverMiddleware, middleware...)
+	}
+}
+
+// SpawnConstraints restricts the nodes a cluster actor may be spawned on, it
+// is ignored by the spawns that are not on a cluster.
+func SpawnConstraints(constraints ...cluster.Constraint) SpawnOption {
+	return func(opts *SpawnOptions) {
+		opts.Constraints = append(opts.Constraints, constraints...)
+	}
+}
+
+// ReliableInbox records in store which messages of reliable channels the
+// actor has handled, so that it keeps discarding their duplicates after a
+// restart. The windows are kept by actor name, the actor must be named.
+func ReliableInbox(store InboxStore) SpawnOption {
+	return func(opts *SpawnOptions) {
+		opts.ReliableInbox = store
+	}
+}
@@ -0,0 +1,321 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/core"
+)
+
+const DefaultStreamWindow = 16
+
+var (
+	ErrStreamCancelled = errors.New("stream cancelled")
+	ErrStreamClosed    = errors.New("stream closed")
+	ErrNotStream       = errors.New("message is not a stream request")
+
+	errStreamAborted = errors.New("stream aborted")
+)
+
+type streamOptions struct {
+	window int
+}
+
+type StreamOption func(opts *streamOptions)
+
+// StreamWindow sets how many items the responder may send ahead of the
+// caller consuming them.
+func StreamWindow(n int) StreamOption {
+	return func(opts *streamOptions) {
+		opts.window = n
+	}
+}
+
+func newStreamFrame(from PID, data interface{}, flag int32) core.Message {
+	return core.Message{From: from, Data: data, Flag: core.MessageFlagStream | flag}
+}
+
+// Stream is the caller side of a server-streaming request opened with
+// OpenStream. It is backed by a child process of the caller, so the stream is
+// cancelled when the caller dies.
+type Stream struct {
+	core.Process
+	ctx      context.Context
+	window   int
+	items    chan interface{}
+	consumed chan struct{}
+	done     chan struct{}
+	err      error
+}
+
+func (p *actorProcess) OpenStream(ctx context.Context, to PID, message interface{}, opt ...StreamOption) (*Stream, error) {
+	opts := streamOptions{window: DefaultStreamWindow}
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.window <= 0 {
+		opts.window = 1
+	}
+
+	s := &Stream{
+		ctx:      ctx,
+		window:   opts.window,
+		items:    make(chan interface{}, opts.window),
+		consumed: make(chan struct{}, opts.window),
+		done:     make(chan struct{}),
+	}
+	process, err := p.Spawn(s, &core.SpawnOptions{})
+	if err != nil {
+		return nil, err
+	}
+	s.Process = process
+
+	request := core.Message{
+		From:   process.Self(),
+		Flag:   core.MessageFlagRequest | core.MessageFlagStreamRequest,
+		Data:   message,
+		SentAt: time.Now(),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		request.Deadline = deadline
+	}
+	if err := process.SendCtx(ctx, to, request); err != nil {
+		process.Kill()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Recv returns the next item of the stream, io.EOF once the responder has
+// completed it, or the error the stream failed with.
+func (s *Stream) Recv() (interface{}, error) {
+	select {
+	case item := <-s.items:
+		select {
+		case s.consumed <- struct{}{}:
+		default:
+		}
+		return item, nil
+	case <-s.done:
+		select {
+		case item := <-s.items:
+			return item, nil
+		default:
+		}
+		return nil, s.err
+	}
+}
+
+// Close cancels the stream, the responder sees ErrStreamCancelled.
+func (s *Stream) Close() {
+	s.Kill()
+}
+
+func (s *Stream) ProcessLoop(process core.Process) error {
+	var (
+		writer  PID
+		pending int
+	)
+	channels := process.ProcessChannels()
+
+	// finish also ends the direction towards the writer, which either
+	// cancels it or, if it has already completed, releases the transport.
+	finish := func(err error) {
+		s.err = err
+		close(s.done)
+		if writer != ZeroPID {
+			process.Send(writer, newStreamFrame(process.Self(), &StreamCancel{}, core.MessageFlagStreamEnd))
+		}
+	}
+
+	// push hands an item over to Recv. The credits keep items within its
+	// buffer, but a responder ignoring them must not keep the loop from
+	// seeing the stream cancelled.
+	push := func(item interface{}) error {
+		select {
+		case s.items <- item:
+			return nil
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-channels.Exit:
+			return ErrStreamCancelled
+		case <-process.Context().Done():
+			return ErrStreamCancelled
+		}
+	}
+
+	for {
+		select {
+		case msg := <-channels.Mailbox:
+			if msg.TestFlag(core.MessageFlagResponse) {
+				// The responder answered with a plain reply instead of a stream.
+				if err, ok := msg.Data.(error); ok {
+					finish(err)
+				} else if err := push(msg.Data); err != nil {
+					finish(err)
+				} else {
+					finish(io.EOF)
+				}
+				return nil
+			}
+
+			switch data := msg.Data.(type) {
+			case *StreamReady:
+				writer = msg.From
+				process.Send(writer, newStreamFrame(process.Self(), &StreamCredit{N: int32(s.window)}, 0))
+			case *StreamEnd:
+				if data.Error != "" {
+					finish(errors.New(data.Error))
+				} else {
+					finish(io.EOF)
+				}
+				return nil
+			default:
+				if err := push(data); err != nil {
+					finish(err)
+					return nil
+				}
+			}
+		case <-s.consumed:
+			pending++
+			if writer != ZeroPID && pending >= (s.window+1)/2 {
+				process.Send(writer, newStreamFrame(process.Self(), &StreamCredit{N: int32(pending)}, 0))
+				pending = 0
+			}
+		case <-s.ctx.Done():
+			finish(s.ctx.Err())
+			return nil
+		case <-channels.Exit:
+			finish(ErrStreamCancelled)
+			return nil
+		case <-process.Context().Done():
+			finish(ErrStreamCancelled)
+			return nil
+		}
+	}
+}
+
+// ServerStream is the responder side of a stream, returned by
+// Context.Stream. Send blocks until the caller has granted enough credit, so
+// a slow caller slows down the responder instead of filling its mailbox.
+type ServerStream struct {
+	process core.Process
+	to      PID
+
+	mu        sync.Mutex
+	credits   int
+	closed    bool
+	cancelled bool
+	signal    chan struct{}
+}
+
+func newServerStream(parent core.Process, to PID) (*ServerStream, error) {
+	s := &ServerStream{to: to, signal: make(chan struct{}, 1)}
+	process, err := parent.Spawn(s, &core.SpawnOptions{})
+	if err != nil {
+		return nil, err
+	}
+	s.process = process
+
+	if err := process.Send(to, newStreamFrame(process.Self(), &StreamReady{}, 0)); err != nil {
+		s.close(process, nil)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Context is done once the caller has cancelled the stream or the responder
+// has died.
+func (s *ServerStream) Context() context.Context {
+	return s.process.Context()
+}
+
+func (s *ServerStream) Send(item interface{}) error {
+	for {
+		s.mu.Lock()
+		if s.cancelled {
+			s.mu.Unlock()
+			return ErrStreamCancelled
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return ErrStreamClosed
+		}
+		if s.credits > 0 {
+			s.credits--
+			s.mu.Unlock()
+			break
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.signal:
+		case <-s.process.Context().Done():
+			return ErrStreamCancelled
+		}
+	}
+
+	if err := s.process.SendCtx(s.process.Context(), s.to, newStreamFrame(s.process.Self(), item, 0)); err != nil {
+		s.process.Kill()
+		return err
+	}
+	return nil
+}
+
+// Close completes the stream, a non-nil err is returned to the caller by
+// Stream.Recv.
+func (s *ServerStream) Close(err error) error {
+	return s.close(s.process, err)
+}
+
+func (s *ServerStream) close(process core.Process, err error) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	defer process.Kill()
+
+	end := &StreamEnd{}
+	if err != nil {
+		end.Error = err.Error()
+	}
+	return process.Send(s.to, newStreamFrame(process.Self(), end, core.MessageFlagStreamEnd))
+}
+
+func (s *ServerStream) ProcessLoop(process core.Process) error {
+	// The caller is told the stream was aborted unless it has been closed or
+	// cancelled by then.
+	defer s.close(process, errStreamAborted)
+
+	channels := process.ProcessChannels()
+	for {
+		select {
+		case msg := <-channels.Mailbox:
+			switch data := msg.Data.(type) {
+			case *StreamCredit:
+				s.mu.Lock()
+				s.credits += int(data.N)
+				s.mu.Unlock()
+				select {
+				case s.signal <- struct{}{}:
+				default:
+				}
+			case *StreamCancel:
+				s.mu.Lock()
+				s.closed, s.cancelled = true, true
+				s.mu.Unlock()
+				return nil
+			}
+		case <-channels.Exit:
+			return nil
+		case <-process.Context().Done():
+			return process.Context().Err()
+		}
+	}
+}
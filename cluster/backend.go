@@ -0,0 +1,228 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend is the store coordinating the nodes of the cluster: the global
+// names and the claims of the grains are keys attached to leases of their
+// node. NewEtcdBackend stores them in etcd, NewMemoryBackend in memory.
+type Backend interface {
+	// Grant returns a lease kept alive until it is revoked, it expires ttl
+	// after its node has died.
+	Grant(ctx context.Context, ttl time.Duration) (Lease, error)
+	// Claim sets key to value attached to lease unless key is set, it returns
+	// the value of key and whether it has been set.
+	Claim(ctx context.Context, key string, value string, lease Lease) (string, bool, error)
+	Get(ctx context.Context, key string) (string, bool, error)
+	// Release deletes key if it is set to value.
+	Release(ctx context.Context, key string, value string) error
+	// Watch calls fn with the keys under prefix, then with their changes,
+	// until ctx is done or the watch fails. The first call has every key and
+	// initial set, it replaces what the caller knows of the keys.
+	Watch(ctx context.Context, prefix string, fn func(events []Event, initial bool)) error
+	// Lock blocks until this node holds the lock key, the returned func
+	// releases it.
+	Lock(ctx context.Context, key string) (func(), error)
+}
+
+// Lease keeps the keys attached to it until it is revoked or expires.
+type Lease interface {
+	// Done is closed once the lease has been revoked or has expired.
+	Done() <-chan struct{}
+	Revoke(ctx context.Context) error
+}
+
+type Event struct {
+	Key     string
+	Value   string
+	Deleted bool
+}
+
+type memoryEntry struct {
+	value string
+	lease *memoryLease
+}
+
+type memoryWatch struct {
+	prefix  string
+	mu      sync.Mutex
+	pending []Event
+	notify  chan struct{}
+}
+
+func (w *memoryWatch) push(e Event) {
+	w.mu.Lock()
+	w.pending = append(w.pending, e)
+	w.mu.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memoryWatch) pop() []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	events := w.pending
+	w.pending = nil
+	return events
+}
+
+type memoryBackend struct {
+	mu      sync.Mutex
+	keys    map[string]memoryEntry
+	watches map[*memoryWatch]struct{}
+	locks   map[string]chan struct{}
+}
+
+// NewMemoryBackend returns a Backend shared by the clusters of this process
+// it is passed to, for tests. Its leases only end when revoked.
+//
+// It is also the Backend of a cluster without a shared store, a single node
+// or nodes routed with StaticRoute: every node then keeps its own names and
+// grains, the names are unique on a node only.
+func NewMemoryBackend() Backend {
+	return &memoryBackend{
+		keys:    make(map[string]memoryEntry),
+		watches: make(map[*memoryWatch]struct{}),
+		locks:   make(map[string]chan struct{}),
+	}
+}
+
+type memoryLease struct {
+	b    *memoryBackend
+	once sync.Once
+	done chan struct{}
+}
+
+func (l *memoryLease) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *memoryLease) Revoke(ctx context.Context) error {
+	l.once.Do(func() {
+		l.b.mu.Lock()
+		for key, entry := range l.b.keys {
+			if entry.lease == l {
+				l.b.delete(key)
+			}
+		}
+		l.b.mu.Unlock()
+		close(l.done)
+	})
+	return nil
+}
+
+func (b *memoryBackend) Grant(ctx context.Context, ttl time.Duration) (Lease, error) {
+	return &memoryLease{b: b, done: make(chan struct{})}, nil
+}
+
+func (b *memoryBackend) Claim(ctx context.Context, key string, value string, lease Lease) (string, bool, error) {
+	l, ok := lease.(*memoryLease)
+	if !ok {
+		return "", false, fmt.Errorf("cluster: claim %s with a %T lease, not granted by the memory backend", key, lease)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if entry, ok := b.keys[key]; ok {
+		return entry.value, false, nil
+	}
+	b.keys[key] = memoryEntry{value: value, lease: l}
+	b.publish(Event{Key: key, Value: value})
+	return value, true, nil
+}
+
+func (b *memoryBackend) Get(ctx context.Context, key string) (string, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.keys[key]
+	return entry.value, ok, nil
+}
+
+func (b *memoryBackend) Release(ctx context.Context, key string, value string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if entry, ok := b.keys[key]; ok && entry.value == value {
+		b.delete(key)
+	}
+	return nil
+}
+
+// delete deletes key, b.mu must be held.
+func (b *memoryBackend) delete(key string) {
+	delete(b.keys, key)
+	b.publish(Event{Key: key, Deleted: true})
+}
+
+// publish sends e to the watches of its key, b.mu must be held.
+func (b *memoryBackend) publish(e Event) {
+	for w := range b.watches {
+		if strings.HasPrefix(e.Key, w.prefix) {
+			w.push(e)
+		}
+	}
+}
+
+func (b *memoryBackend) Watch(ctx context.Context, prefix string, fn func(events []Event, initial bool)) error {
+	w := &memoryWatch{prefix: prefix, notify: make(chan struct{}, 1)}
+	var events []Event
+	b.mu.Lock()
+	for key, entry := range b.keys {
+		if strings.HasPrefix(key, prefix) {
+			events = append(events, Event{Key: key, Value: entry.value})
+		}
+	}
+	b.watches[w] = struct{}{}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.watches, w)
+		b.mu.Unlock()
+	}()
+
+	fn(events, true)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.notify:
+			if events := w.pop(); len(events) > 0 {
+				fn(events, false)
+			}
+		}
+	}
+}
+
+func (b *memoryBackend) lock(key string) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lock, ok := b.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		b.locks[key] = lock
+	}
+	return lock
+}
+
+func (b *memoryBackend) Lock(ctx context.Context, key string) (func(), error) {
+	lock := b.lock(key)
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -2,7 +2,6 @@ package cluster
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/geniuscirno/go-actor/cluster/registry"
@@ -10,19 +9,30 @@ import (
 	"github.com/geniuscirno/go-actor/core"
 	"github.com/geniuscirno/go-actor/remote"
 	"github.com/geniuscirno/go-actor/remote/attributes"
-	clientv3 "go.etcd.io/etcd/client/v3"
-	"go.etcd.io/etcd/client/v3/concurrency"
 	"log"
+	"math/rand"
 	"net"
+	"sort"
 	"sync"
 	"time"
 )
 
+var (
+	ErrNoNode = errors.New("no node")
+	// ErrConstraint is returned by Spawn when this node does not satisfy the
+	// constraints of the process.
+	ErrConstraint = errors.New("cluster: node does not satisfy the spawn constraints")
+)
+
 type Options struct {
-	registrar registry.Registrar
-	discovery registry.Discovery
-	address   string
-	port      int
+	registrar   registry.Registrar
+	discovery   registry.Discovery
+	address     string
+	port        int
+	placement   Placement
+	partitioned bool
+	kinds       []string
+	attributes  map[string]string
 }
 
 type Option func(opts *Options)
@@ -45,6 +55,57 @@ func Address(addr string) Option {
 	}
 }
 
+// Port sets the port the node listens on, a random port by default.
+func Port(port int) Option {
+	return func(opts *Options) {
+		opts.port = port
+	}
+}
+
+// Kinds advertises the kinds of grains this node hosts, the grains of a kind
+// are only placed on the nodes advertising it. A node advertising no kinds
+// hosts every kind.
+func Kinds(kinds ...string) Option {
+	return func(opts *Options) {
+		opts.kinds = append(opts.kinds, kinds...)
+	}
+}
+
+// Attributes advertises free-form attributes of this node, such as its role,
+// matched by FindEndpoints and the spawn constraints.
+func Attributes(attrs map[string]string) Option {
+	return func(opts *Options) {
+		if opts.attributes == nil {
+			opts.attributes = make(map[string]string)
+		}
+		for k, v := range attrs {
+			opts.attributes[k] = v
+		}
+	}
+}
+
+// GrainPlacement sets how the node activating a grain is chosen,
+// RandomPlacement by default.
+func GrainPlacement(placement Placement) Option {
+	return func(opts *Options) {
+		opts.placement = placement
+	}
+}
+
+// PartitionedGrains places the grains with a consistent hash ring of the
+// members instead of claiming them in the backend, the grains of a node that
+// has died are activated elsewhere as soon as it has left the members.
+//
+// When the members change, a grain now placed on another node is stopped and
+// the messages left in its mailbox are forwarded to its new node. The
+// messages still sent to it by nodes that have not seen the change yet are
+// redirected to its new node once it has stopped.
+func PartitionedGrains() Option {
+	return func(opts *Options) {
+		opts.partitioned = true
+	}
+}
+
 func localIPV4Addr() (string, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
@@ -89,21 +150,35 @@ type Cluster struct {
 	server   *remote.Server
 	resolver resolver.Resolver
 
-	lease   clientv3.Lease
-	watcher clientv3.Watcher
-	client  *clientv3.Client
+	backend Backend
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 
 	mu         sync.RWMutex
 	endpoints  map[string]*remote.Endpoint
 	globalPids map[string]core.PID
+
+	watchMu       sync.Mutex
+	watchID       int
+	memberWatches map[int]func(members []string)
+
+	grainMu     sync.RWMutex
+	kinds       map[string]GrainProducer
+	activations map[string]*grainBehavior
+	identities  identityLookup
 }
 
-func NewCluster(node core.Node, client *clientv3.Client, opt ...Option) (*Cluster, error) {
-	opts := Options{}
+// NewCluster joins node to the cluster coordinated by backend, such as
+// NewEtcdBackend for a cluster of several nodes.
+func NewCluster(node core.Node, backend Backend, opt ...Option) (*Cluster, error) {
+	opts := Options{placement: RandomPlacement()}
 	for _, o := range opt {
 		o(&opts)
 	}
 	cluster := &Cluster{node: node, opts: opts}
+	cluster.ctx, cluster.cancel = context.WithCancel(context.Background())
 	if cluster.opts.address == "" {
 		address, err := localIPV4Addr()
 		if err != nil {
@@ -115,19 +190,32 @@ func NewCluster(node core.Node, client *clientv3.Client, opt ...Option) (*Cluste
 	cluster.server = remote.NewServer(node, fmt.Sprintf("%s:%d", cluster.opts.address, cluster.opts.port))
 	cluster.endpoints = make(map[string]*remote.Endpoint)
 	cluster.globalPids = make(map[string]core.PID)
-	cluster.client = client
-	cluster.watcher = clientv3.NewWatcher(client)
-	cluster.lease = clientv3.NewLease(client)
+	cluster.memberWatches = make(map[int]func(members []string))
+	cluster.kinds = make(map[string]GrainProducer)
+	cluster.activations = make(map[string]*grainBehavior)
+	cluster.backend = backend
+	// Grains may be activated as soon as the server is started.
+	if cluster.opts.partitioned {
+		l := newPartitionIdentityLookup(cluster)
+		cluster.WatchMembers(func([]string) { l.rebalance() })
+		l.rebalance()
+		cluster.identities = l
+	} else {
+		l := newClaimIdentityLookup(cluster)
+		go l.watch()
+		cluster.identities = l
+	}
 
 	if err := cluster.server.Start(); err != nil {
 		return nil, err
 	}
 	node.Join(cluster)
+	node.SetActivator(cluster)
 
 	if cluster.opts.registrar != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
-		if err := cluster.opts.registrar.Register(ctx, &registry.Node{Name: node.Name(), Address: cluster.server.Address()}); err != nil {
+		if err := cluster.opts.registrar.Register(ctx, cluster.self()); err != nil {
 			return nil, err
 		}
 		go cluster.opts.registrar.KeepAlive(context.TODO())
@@ -144,118 +232,86 @@ func NewCluster(node core.Node, client *clientv3.Client, opt ...Option) (*Cluste
 	return cluster, nil
 }
 
-func (c *Cluster) Spawn(behavior core.ProcessBehavior, opts *core.SpawnOptions) (core.Process, error) {
-	if opts.Name == "" {
-		return nil, errors.New("cluster process must has a name")
+// self returns this node as advertised by the registry.
+func (c *Cluster) self() *registry.Node {
+	return &registry.Node{
+		Name:       c.node.Name(),
+		Address:    c.server.Address(),
+		Kinds:      c.opts.kinds,
+		Attributes: c.opts.attributes,
 	}
+}
 
-	s, err := concurrency.NewSession(c.client)
-	if err != nil {
-		return nil, err
+// Constraint restricts the nodes a process may be spawned on to the nodes
+// hosting Kind, if set, and whose attributes match Attributes.
+type Constraint struct {
+	Kind       string
+	Attributes *attributes.Attributes
+}
+
+func (c Constraint) match(kinds []string, attrs *attributes.Attributes) bool {
+	return hostsKind(kinds, c.Kind) && attrs.Match(c.Attributes)
+}
+
+func hostsKind(kinds []string, kind string) bool {
+	if kind == "" || len(kinds) == 0 {
+		return true
 	}
-	defer s.Close()
-	mu := concurrency.NewMutex(s, fmt.Sprintf("lock/%s", opts.Name))
-	if err := mu.Lock(context.TODO()); err != nil {
-		return nil, err
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
 	}
-	defer mu.Unlock(context.TODO())
+	return false
+}
 
-	resp, err := c.client.Get(context.TODO(), fmt.Sprintf("globalPids/%s", opts.Name))
-	if err != nil {
-		panic(err)
+// Spawn spawns a process named opts.Name on this node, the name being unique
+// in the cluster.
+func (c *Cluster) Spawn(behavior core.ProcessBehavior, opts *core.SpawnOptions) (core.Process, error) {
+	return c.SpawnConstrained(behavior, opts)
+}
+
+// SpawnConstrained is Spawn returning ErrConstraint if this node does not
+// satisfy constraints, FindMembers returns the nodes that do.
+func (c *Cluster) SpawnConstrained(behavior core.ProcessBehavior, opts *core.SpawnOptions, constraints ...Constraint) (core.Process, error) {
+	if opts.Name == "" {
+		return nil, errors.New("cluster process must has a name")
 	}
-	if resp.Count > 0 {
-		return nil, errors.New("already spawn on other nodes")
+	attrs := attributes.New(c.opts.attributes)
+	for _, constraint := range constraints {
+		if !constraint.match(c.opts.kinds, attrs) {
+			return nil, ErrConstraint
+		}
 	}
 
-	grant, err := c.lease.Grant(context.Background(), int64((time.Second * 15).Seconds()))
+	leaseID, err := c.registerName(opts.Name)
 	if err != nil {
 		return nil, err
 	}
-
-	b, err := json.Marshal(core.PID{
-		Node: c.node.Name(),
-		ID:   opts.Name,
-	})
+	process, err := c.node.Spawn(behavior, opts)
 	if err != nil {
+		c.releaseName(opts.Name, leaseID)
 		return nil, err
 	}
 
-	if _, err := c.client.Put(context.Background(), fmt.Sprintf("globalPids/%s", opts.Name), string(b), clientv3.WithLease(grant.ID)); err != nil {
-		panic(err)
-	}
+	c.wg.Add(1)
 	go func() {
-		kac, err := c.lease.KeepAlive(context.TODO(), grant.ID)
-		if err != nil {
-			panic(err)
-		}
-
-		for {
-			select {
-			case <-kac:
-			}
-		}
+		defer c.wg.Done()
+		c.keepName(process, leaseID)
 	}()
-
-	return c.node.Spawn(behavior, opts)
-}
-
-func (c *Cluster) watchGlobalPids() {
-	resp, err := c.client.Get(context.TODO(), "globalPids/", clientv3.WithPrefix())
-	if err != nil {
-		panic(err)
-	}
-	for _, kv := range resp.Kvs {
-		pid := core.PID{}
-		if err := json.Unmarshal(kv.Value, &pid); err != nil {
-			continue
-		}
-		log.Println("cluster: add global pid", pid)
-		c.mu.Lock()
-		c.globalPids[pid.ID] = pid
-		c.mu.Unlock()
-	}
-
-	wch := c.watcher.Watch(context.TODO(), "globalPids/", clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
-	for {
-		select {
-		case ch, ok := <-wch:
-			if !ok {
-				return
-			}
-
-			c.mu.Lock()
-			for _, event := range ch.Events {
-				pid := core.PID{}
-				switch event.Type {
-				case clientv3.EventTypePut:
-					if err := json.Unmarshal(event.Kv.Value, &pid); err != nil {
-						continue
-					}
-					log.Println("cluster: add global pid", pid)
-					c.globalPids[pid.ID] = pid
-				case clientv3.EventTypeDelete:
-					log.Println("cluster: delete global pid", string(event.Kv.Key))
-					delete(c.globalPids, string(event.Kv.Key))
-				}
-			}
-			c.mu.Unlock()
-		}
-	}
+	return process, nil
 }
 
 func (c *Cluster) Stop() {
-	c.lease.Close()
-	for _, pid := range c.globalPids {
-		if pid.Node == c.node.Name() {
-			c.client.Delete(context.TODO(), fmt.Sprintf("globalPids/%s", pid.ID))
-		}
-	}
+	// Releases the names and the grains of this node.
+	c.cancel()
+	c.wg.Wait()
+	c.identities.Stop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 	if c.opts.registrar != nil {
-		c.opts.registrar.Deregister(ctx, &registry.Node{Name: c.node.Name(), Address: c.server.Address()})
+		c.opts.registrar.Deregister(ctx, c.self())
 	}
 	if c.resolver != nil {
 		c.resolver.Close()
@@ -263,36 +319,56 @@ func (c *Cluster) Stop() {
 	c.server.Stop()
 }
 
+// Lock blocks until this node holds the cluster wide lock key, the returned
+// func releases it.
+func (c *Cluster) Lock(ctx context.Context, key string) (func(), error) {
+	return c.backend.Lock(ctx, "lock/"+key)
+}
+
 func (c *Cluster) SendMessage(ctx context.Context, to core.PID, message core.Message) error {
-	c.mu.RLock()
+	if kind, identity, ok := ParseGrainID(to.ID); ok && to.Node == "" {
+		pid, err := c.GrainPID(ctx, kind, identity)
+		if err != nil {
+			return err
+		}
+		return c.node.SendMessage(ctx, pid, message)
+	}
+
 	if to.Node == "" {
-		pid, ok := c.globalPids[to.ID]
-		if ok {
-			c.mu.RUnlock()
+		if pid, ok := c.Whereis(to.ID); ok {
 			to.Node = pid.Node
 			return c.node.SendMessage(ctx, to, message)
 		}
 	}
+
+	c.mu.RLock()
 	ep, ok := c.getEndpoint(to.Node)
 	if !ok {
 		c.mu.RUnlock()
-		return errors.New("no node")
+		return ErrNoNode
 	}
 	c.mu.RUnlock()
 
 	return ep.SendMessage(ctx, to, message)
 }
 
-func (c *Cluster) StaticRoute(nodeName string, nodeAddr string, attrs *attributes.Attributes) error {
+// StaticRoute adds the node nodeName listening on nodeAddr to the members,
+// with the attributes and the kinds of grains it advertises.
+func (c *Cluster) StaticRoute(nodeName string, nodeAddr string, attrs *attributes.Attributes, kinds ...string) error {
 	ep, err := remote.NewEndpoint(nodeName, nodeAddr)
 	if err != nil {
 		return err
 	}
+	if attrs == nil {
+		attrs = attributes.New(nil)
+	}
+	ep.Attributes, ep.Kinds = attrs, kinds
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	c.updateEndpoint(ep)
+	c.mu.Unlock()
+
+	c.notifyMembers()
 	return nil
 }
 
@@ -302,6 +378,8 @@ func (c *Cluster) updateEndpoint(ep *remote.Endpoint) {
 
 func (c *Cluster) UpdateState(state resolver.State) error {
 	log.Println("cluster: UpdateState", state.Addresses)
+	defer c.notifyMembers()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -319,6 +397,7 @@ func (c *Cluster) UpdateState(state resolver.State) error {
 			if err != nil {
 				continue
 			}
+			ep.Kinds, ep.Attributes = a.Kinds, attributes.New(a.Attributes)
 			c.updateEndpoint(ep)
 			continue
 		}
@@ -330,8 +409,13 @@ func (c *Cluster) UpdateState(state resolver.State) error {
 			if err != nil {
 				continue
 			}
+			ep.Kinds, ep.Attributes = a.Kinds, attributes.New(a.Attributes)
 			c.updateEndpoint(ep)
+			continue
 		}
+
+		// 节点的 kinds 或者属性改变了
+		ep.Kinds, ep.Attributes = a.Kinds, attributes.New(a.Attributes)
 	}
 
 	for name, ep := range c.endpoints {
@@ -371,27 +455,90 @@ func (c *Cluster) Endpoints() []*remote.Endpoint {
 	return results
 }
 
-//func (c *Cluster) FindEndpoints(attrs *attributes.Attributes) []*Endpoint {
-//	c.mu.RLock()
-//	defer c.mu.RUnlock()
-//
-//	var results []*Endpoint
-//	for _, ep := range c.endpoints {
-//		if ep.Attributes.Match(attrs) {
-//			results = append(results, ep)
-//		}
-//	}
-//	return results
-//}
-//
-//func (c *Cluster) FindRandomEndpoint(attrs *attributes.Attributes) (*Endpoint, bool) {
-//	c.mu.RLock()
-//	defer c.mu.RUnlock()
-//
-//	for _, ep := range c.endpoints {
-//		if ep.Attributes.Match(attrs) {
-//			return ep, true
-//		}
-//	}
-//	return nil, false
-//}
+// Members returns the sorted names of the nodes of the cluster, including the
+// local node.
+func (c *Cluster) Members() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	members := make([]string, 0, len(c.endpoints)+1)
+	members = append(members, c.node.Name())
+	for name := range c.endpoints {
+		members = append(members, name)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// WatchMembers calls f with the members of the cluster every time the nodes
+// resolved for the cluster are updated, until the returned cancel func is
+// called. f must not block.
+func (c *Cluster) WatchMembers(f func(members []string)) (cancel func()) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	c.watchID++
+	id := c.watchID
+	c.memberWatches[id] = f
+	return func() {
+		c.watchMu.Lock()
+		defer c.watchMu.Unlock()
+
+		delete(c.memberWatches, id)
+	}
+}
+
+func (c *Cluster) notifyMembers() {
+	members := c.Members()
+
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	for _, f := range c.memberWatches {
+		f(members)
+	}
+}
+
+// FindEndpoints returns the endpoints of the nodes whose attributes match
+// attrs, all of them if attrs is nil.
+func (c *Cluster) FindEndpoints(attrs *attributes.Attributes) []*remote.Endpoint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var results []*remote.Endpoint
+	for _, ep := range c.endpoints {
+		if ep.Attributes.Match(attrs) {
+			results = append(results, ep)
+		}
+	}
+	return results
+}
+
+// FindRandomEndpoint returns the endpoint of a random node whose attributes
+// match attrs.
+func (c *Cluster) FindRandomEndpoint(attrs *attributes.Attributes) (*remote.Endpoint, bool) {
+	results := c.FindEndpoints(attrs)
+	if len(results) == 0 {
+		return nil, false
+	}
+	return results[rand.Intn(len(results))], true
+}
+
+// FindMembers returns the sorted names of the members satisfying constraint,
+// including the local node.
+func (c *Cluster) FindMembers(constraint Constraint) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var members []string
+	if constraint.match(c.opts.kinds, attributes.New(c.opts.attributes)) {
+		members = append(members, c.node.Name())
+	}
+	for name, ep := range c.endpoints {
+		if constraint.match(ep.Kinds, ep.Attributes) {
+			members = append(members, name)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
@@ -0,0 +1,153 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+type etcdBackend struct {
+	client *clientv3.Client
+}
+
+// NewEtcdBackend returns a Backend keeping the keys of the cluster in etcd.
+func NewEtcdBackend(client *clientv3.Client) Backend {
+	return &etcdBackend{client: client}
+}
+
+type etcdLease struct {
+	client *clientv3.Client
+	id     clientv3.LeaseID
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (l *etcdLease) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *etcdLease) Revoke(ctx context.Context) error {
+	l.cancel()
+	_, err := l.client.Revoke(ctx, l.id)
+	return err
+}
+
+func (b *etcdBackend) Grant(ctx context.Context, ttl time.Duration) (Lease, error) {
+	grant, err := b.client.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	kctx, cancel := context.WithCancel(context.Background())
+	kac, err := b.client.KeepAlive(kctx, grant.ID)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	l := &etcdLease{client: b.client, id: grant.ID, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		for range kac {
+		}
+		close(l.done)
+	}()
+	return l, nil
+}
+
+func (b *etcdBackend) Claim(ctx context.Context, key string, value string, lease Lease) (string, bool, error) {
+	l, ok := lease.(*etcdLease)
+	if !ok {
+		return "", false, fmt.Errorf("cluster: claim %s with a %T lease, not granted by the etcd backend", key, lease)
+	}
+	resp, err := b.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value, clientv3.WithLease(l.id))).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		return "", false, err
+	}
+	if resp.Succeeded {
+		return value, true, nil
+	}
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) == 0 {
+		// Deleted in between, the caller claims it again.
+		return "", false, nil
+	}
+	return string(kvs[0].Value), false, nil
+}
+
+func (b *etcdBackend) Get(ctx context.Context, key string) (string, bool, error) {
+	resp, err := b.client.Get(ctx, key)
+	if err != nil {
+		return "", false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", false, nil
+	}
+	return string(resp.Kvs[0].Value), true, nil
+}
+
+func (b *etcdBackend) Release(ctx context.Context, key string, value string) error {
+	_, err := b.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", value)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	return err
+}
+
+func (b *etcdBackend) Watch(ctx context.Context, prefix string, fn func(events []Event, initial bool)) error {
+	resp, err := b.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	events := make([]Event, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		events = append(events, Event{Key: string(kv.Key), Value: string(kv.Value)})
+	}
+	fn(events, true)
+
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	wch := b.client.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	for ch := range wch {
+		if err := ch.Err(); err != nil {
+			return err
+		}
+		events := make([]Event, 0, len(ch.Events))
+		for _, event := range ch.Events {
+			events = append(events, Event{
+				Key:     string(event.Kv.Key),
+				Value:   string(event.Kv.Value),
+				Deleted: event.Type == clientv3.EventTypeDelete,
+			})
+		}
+		fn(events, false)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.New("watch chan closed")
+}
+
+func (b *etcdBackend) Lock(ctx context.Context, key string) (func(), error) {
+	session, err := concurrency.NewSession(b.client, concurrency.WithTTL(15))
+	if err != nil {
+		return nil, err
+	}
+	mu := concurrency.NewMutex(session, key)
+	if err := mu.Lock(ctx); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		mu.Unlock(ctx)
+		session.Close()
+	}, nil
+}
@@ -0,0 +1,130 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/geniuscirno/go-actor/core"
+)
+
+// The processes spawned by Cluster.Spawn register their name under
+// globalPids/ in the backend with a lease of their own, kept alive while the
+// process runs. The name is released once the process has exited, the
+// cluster has stopped, or the node has died and the lease has expired.
+
+const globalPidPrefix = "globalPids/"
+
+var ErrNameTaken = errors.New("cluster: name already registered")
+
+// Whereis returns the PID of the process registered under name in the
+// cluster.
+func (c *Cluster) Whereis(name string) (core.PID, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pid, ok := c.globalPids[name]
+	return pid, ok
+}
+
+// registerName claims name for this node, it returns ErrNameTaken if another
+// process has claimed it.
+func (c *Cluster) registerName(name string) (Lease, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, time.Second*5)
+	defer cancel()
+
+	pid := core.PID{Node: c.node.Name(), ID: name}
+	b, err := json.Marshal(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	lease, err := c.backend.Grant(ctx, time.Second*15)
+	if err != nil {
+		return nil, err
+	}
+	_, ok, err := c.backend.Claim(ctx, globalPidPrefix+name, string(b), lease)
+	if err == nil && !ok {
+		err = ErrNameTaken
+	}
+	if err != nil {
+		c.releaseName(name, lease)
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.globalPids[name] = pid
+	c.mu.Unlock()
+	return lease, nil
+}
+
+// releaseName revokes the lease of name, removing it from the backend.
+func (c *Cluster) releaseName(name string, lease Lease) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := lease.Revoke(ctx); err != nil {
+		log.Printf("cluster: release name %s failed: %v\n", name, err)
+	}
+}
+
+// keepName keeps the name of process registered until the process exits or
+// the cluster stops. The process is stopped if the lease is lost, as another
+// node may claim the name from then on.
+func (c *Cluster) keepName(process core.Process, lease Lease) {
+	name := process.Self().ID
+	select {
+	case <-process.Context().Done():
+		c.releaseName(name, lease)
+	case <-c.ctx.Done():
+		c.releaseName(name, lease)
+	case <-lease.Done():
+		log.Printf("cluster: lease of name %s lost, stopping %v\n", name, process.Self())
+		process.Stop()
+	}
+}
+
+// watchGlobalPids caches the registered names, watching them again whenever
+// the watch fails until the cluster stops.
+func (c *Cluster) watchGlobalPids() {
+	for c.ctx.Err() == nil {
+		err := c.backend.Watch(c.ctx, globalPidPrefix, c.updateGlobalPids)
+		if err != nil && c.ctx.Err() == nil {
+			log.Println("cluster: watch global pids failed:", err)
+			t := time.NewTimer(time.Second)
+			select {
+			case <-c.ctx.Done():
+			case <-t.C:
+			}
+			t.Stop()
+		}
+	}
+}
+
+func (c *Cluster) updateGlobalPids(events []Event, initial bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if initial {
+		c.globalPids = make(map[string]core.PID, len(events))
+	}
+	for _, event := range events {
+		name := strings.TrimPrefix(event.Key, globalPidPrefix)
+		if event.Deleted {
+			log.Println("cluster: delete global pid", name)
+			delete(c.globalPids, name)
+			continue
+		}
+		pid := core.PID{}
+		if err := json.Unmarshal([]byte(event.Value), &pid); err != nil {
+			continue
+		}
+		if !initial {
+			log.Println("cluster: add global pid", pid)
+		}
+		c.globalPids[pid.ID] = pid
+	}
+}
@@ -0,0 +1,452 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/core"
+	"github.com/geniuscirno/go-actor/hashring"
+)
+
+// Grains are virtual actors addressed by kind and identity. A grain is
+// activated on a node the first time a message is sent to it.
+//
+// By default the node claims the grain with a key under grains/ in the backend
+// attached to its lease, so that the grain is activated elsewhere once the
+// node has died.
+// With PartitionedGrains, the node of a grain is given by a consistent hash
+// ring of the members instead, without any round trip to the backend.
+//
+// In both cases, the grains of a kind are only activated on the nodes
+// advertising the kind with the Kinds option.
+
+const (
+	grainIDPrefix  = "grain/"
+	grainKeyPrefix = "grains/"
+)
+
+var ErrUnknownKind = errors.New("cluster: unknown grain kind")
+
+// GrainProducer returns the behavior of the grain of identity.
+type GrainProducer func(identity string) core.ProcessBehavior
+
+// Placement chooses the node activating a grain claimed in the backend
+// among the members hosting its kind.
+type Placement interface {
+	Place(kind string, identity string, members []string) (string, bool)
+}
+
+type randomPlacement struct{}
+
+// RandomPlacement activates grains on a random member, it is the default
+// placement.
+func RandomPlacement() Placement {
+	return randomPlacement{}
+}
+
+func (randomPlacement) Place(kind string, identity string, members []string) (string, bool) {
+	if len(members) == 0 {
+		return "", false
+	}
+	return members[rand.Intn(len(members))], true
+}
+
+// GrainID returns the ID of the PID of a grain, the node of the PID may be
+// left empty for the cluster to find it.
+func GrainID(kind string, identity string) string {
+	return grainIDPrefix + kind + "/" + identity
+}
+
+// ParseGrainID returns the kind and the identity of a grain ID.
+func ParseGrainID(id string) (kind string, identity string, ok bool) {
+	if !strings.HasPrefix(id, grainIDPrefix) {
+		return "", "", false
+	}
+	return strings.Cut(strings.TrimPrefix(id, grainIDPrefix), "/")
+}
+
+// identityLookup finds the node of the grains and claims the grains activated
+// on this node.
+type identityLookup interface {
+	// Lookup returns the node where the grain is, or is to be, activated.
+	Lookup(ctx context.Context, kind string, identity string) (string, error)
+	// Claim is called before activating a grain on this node, it returns a
+	// *core.RedirectError if the grain belongs to another node.
+	Claim(ctx context.Context, id string) error
+	// Release is called once the grain has stopped on this node.
+	Release(id string)
+	// Stop is called once the cluster has stopped.
+	Stop()
+}
+
+// RegisterKind registers the grains of kind, every node of the cluster must
+// register the same kinds before messages are sent to them.
+func (c *Cluster) RegisterKind(kind string, producer GrainProducer) {
+	c.grainMu.Lock()
+	defer c.grainMu.Unlock()
+
+	c.kinds[kind] = producer
+}
+
+// GrainPID returns the PID of the grain of kind and identity, choosing the
+// node activating it if it is not active.
+func (c *Cluster) GrainPID(ctx context.Context, kind string, identity string) (core.PID, error) {
+	node, err := c.identities.Lookup(ctx, kind, identity)
+	if err != nil {
+		return core.PID{}, err
+	}
+	return core.PID{Node: node, ID: GrainID(kind, identity)}, nil
+}
+
+// Activate implements core.Activator, it activates the grains placed on this
+// node.
+func (c *Cluster) Activate(pid core.PID) (core.Process, error) {
+	kind, identity, ok := ParseGrainID(pid.ID)
+	if !ok {
+		return nil, core.ErrProcessNotFound
+	}
+	c.grainMu.RLock()
+	producer, ok := c.kinds[kind]
+	c.grainMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKind
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := c.identities.Claim(ctx, pid.ID); err != nil {
+		return nil, err
+	}
+
+	behavior := &grainBehavior{ProcessBehavior: producer(identity), cluster: c, id: pid.ID}
+	return c.node.Spawn(behavior, &core.SpawnOptions{Name: pid.ID})
+}
+
+// grainBehavior releases the claim of a grain once it has stopped, so that
+// it may be activated elsewhere, and forwards the messages left in its mailbox
+// to the next activation.
+type grainBehavior struct {
+	core.ProcessBehavior
+	cluster *Cluster
+	id      string
+	process core.Process
+}
+
+func (b *grainBehavior) ProcessLoop(process core.Process) error {
+	b.process = process
+	b.cluster.grainMu.Lock()
+	b.cluster.activations[b.id] = b
+	b.cluster.grainMu.Unlock()
+
+	defer func() {
+		b.cluster.grainMu.Lock()
+		delete(b.cluster.activations, b.id)
+		b.cluster.grainMu.Unlock()
+		b.cluster.identities.Release(b.id)
+		go b.forwardQueued()
+	}()
+	return b.ProcessBehavior.ProcessLoop(process)
+}
+
+// forwardQueued waits until the process has been removed from the node, so
+// that the messages sent to the grain activate it again, then sends the
+// messages left in its mailbox to the grain, wherever it now belongs.
+func (b *grainBehavior) forwardQueued() {
+	<-b.process.Context().Done()
+
+	mailbox := b.process.ProcessChannels().Mailbox
+	for {
+		var message core.Message
+		select {
+		case message = <-mailbox:
+		default:
+			return
+		}
+		if b.cluster.ctx.Err() != nil {
+			log.Printf("cluster: drop message of grain %s, the cluster has stopped\n", b.id)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		err := b.cluster.SendMessage(ctx, core.PID{ID: b.id}, message)
+		cancel()
+		if err != nil {
+			log.Printf("cluster: forward message of grain %s failed: %v\n", b.id, err)
+		}
+	}
+}
+
+// claimIdentityLookup claims the grains in the backend.
+type claimIdentityLookup struct {
+	c *Cluster
+
+	mu      sync.RWMutex
+	grains  map[string]string
+	lease   Lease
+	claimed map[string]Lease
+}
+
+func newClaimIdentityLookup(c *Cluster) *claimIdentityLookup {
+	return &claimIdentityLookup{c: c, grains: make(map[string]string), claimed: make(map[string]Lease)}
+}
+
+func (l *claimIdentityLookup) Lookup(ctx context.Context, kind string, identity string) (string, error) {
+	id := GrainID(kind, identity)
+
+	l.mu.RLock()
+	node, ok := l.grains[id]
+	l.mu.RUnlock()
+	if ok {
+		return node, nil
+	}
+
+	node, ok, err := l.c.backend.Get(ctx, grainKeyPrefix+id)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return node, nil
+	}
+
+	node, ok = l.c.opts.placement.Place(kind, identity, l.c.FindMembers(Constraint{Kind: kind}))
+	if !ok {
+		return "", ErrNoNode
+	}
+	return node, nil
+}
+
+func (l *claimIdentityLookup) Claim(ctx context.Context, id string) error {
+	lease, err := l.getLease(ctx)
+	if err != nil {
+		return err
+	}
+
+	self := l.c.node.Name()
+	for {
+		node, ok, err := l.c.backend.Claim(ctx, grainKeyPrefix+id, self, lease)
+		if err != nil {
+			return err
+		}
+		if ok || node == self {
+			l.mu.Lock()
+			l.claimed[id] = lease
+			l.mu.Unlock()
+			return nil
+		}
+		if node != "" {
+			return &core.RedirectError{To: core.PID{Node: node, ID: id}}
+		}
+
+		// Released by its holder in the meantime, claimed again.
+		t := time.NewTimer(time.Millisecond * 10)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// getLease returns the lease the grains of this node are attached to,
+// granting it the first time.
+func (l *claimIdentityLookup) getLease(ctx context.Context) (Lease, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lease != nil {
+		return l.lease, nil
+	}
+
+	lease, err := l.c.backend.Grant(ctx, time.Second*15)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-lease.Done()
+		// The claims of the grains are gone with the lease, the next
+		// activation grants a new one.
+		if l.c.ctx.Err() == nil {
+			log.Println("cluster: grain lease lost")
+		}
+		l.mu.Lock()
+		if l.lease == lease {
+			l.lease = nil
+		}
+		var lost []string
+		for id, claimed := range l.claimed {
+			if claimed == lease {
+				lost = append(lost, id)
+			}
+		}
+		l.mu.Unlock()
+		if l.c.ctx.Err() == nil {
+			l.stopGrains(lost)
+		}
+	}()
+	l.lease = lease
+	return lease, nil
+}
+
+// stopGrains stops the grains whose claims have been lost, as another node may
+// activate them from then on.
+func (l *claimIdentityLookup) stopGrains(ids []string) {
+	l.c.grainMu.RLock()
+	var stopped []core.Process
+	for _, id := range ids {
+		if b, ok := l.c.activations[id]; ok {
+			stopped = append(stopped, b.process)
+		}
+	}
+	l.c.grainMu.RUnlock()
+
+	for _, p := range stopped {
+		log.Printf("cluster: claim of grain %s lost, stopping\n", p.Self().ID)
+		p.Stop()
+	}
+}
+
+func (l *claimIdentityLookup) Release(id string) {
+	l.mu.Lock()
+	delete(l.claimed, id)
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	key := grainKeyPrefix + id
+	if err := l.c.backend.Release(ctx, key, l.c.node.Name()); err != nil {
+		log.Printf("cluster: release grain %s failed: %v\n", key, err)
+	}
+}
+
+// Stop revokes the lease of the grains, releasing the claims of the grains
+// still active.
+func (l *claimIdentityLookup) Stop() {
+	l.mu.Lock()
+	lease := l.lease
+	l.lease = nil
+	l.mu.Unlock()
+
+	if lease == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	lease.Revoke(ctx)
+}
+
+// watch caches the nodes of the active grains until the cluster stops.
+func (l *claimIdentityLookup) watch() {
+	for l.c.ctx.Err() == nil {
+		err := l.c.backend.Watch(l.c.ctx, grainKeyPrefix, l.update)
+		if err != nil && l.c.ctx.Err() == nil {
+			log.Println("cluster: watch grains failed:", err)
+			t := time.NewTimer(time.Second)
+			select {
+			case <-l.c.ctx.Done():
+			case <-t.C:
+			}
+			t.Stop()
+		}
+	}
+}
+
+func (l *claimIdentityLookup) update(events []Event, initial bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if initial {
+		l.grains = make(map[string]string, len(events))
+	}
+	for _, event := range events {
+		id := strings.TrimPrefix(event.Key, grainKeyPrefix)
+		if event.Deleted {
+			delete(l.grains, id)
+		} else {
+			l.grains[id] = event.Value
+		}
+	}
+}
+
+// partitionIdentityLookup maps grains to the members hosting their kind with a
+// consistent hash ring per kind. When the members change, the grains whose
+// node has changed are handed over: they are stopped and their queued messages
+// forwarded, so that the new node activates them. During the change, the nodes
+// may briefly disagree and a grain be active on two nodes.
+type partitionIdentityLookup struct {
+	c *Cluster
+
+	mu    sync.Mutex
+	rings map[string]*hashring.Ring
+}
+
+func newPartitionIdentityLookup(c *Cluster) *partitionIdentityLookup {
+	return &partitionIdentityLookup{c: c, rings: make(map[string]*hashring.Ring)}
+}
+
+// owner returns the node of the grain id, building the ring of its kind from
+// the members the first time.
+func (l *partitionIdentityLookup) owner(id string) (string, bool) {
+	kind, _, ok := ParseGrainID(id)
+	if !ok {
+		return "", false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ring, ok := l.rings[kind]
+	if !ok {
+		ring = hashring.New(hashring.DefaultReplicas, l.c.FindMembers(Constraint{Kind: kind})...)
+		l.rings[kind] = ring
+	}
+	return ring.Get(id)
+}
+
+func (l *partitionIdentityLookup) Lookup(ctx context.Context, kind string, identity string) (string, error) {
+	node, ok := l.owner(GrainID(kind, identity))
+	if !ok {
+		return "", ErrNoNode
+	}
+	return node, nil
+}
+
+func (l *partitionIdentityLookup) Claim(ctx context.Context, id string) error {
+	if node, ok := l.owner(id); ok && node != l.c.node.Name() {
+		return &core.RedirectError{To: core.PID{Node: node, ID: id}}
+	}
+	return nil
+}
+
+func (l *partitionIdentityLookup) Release(id string) {}
+
+func (l *partitionIdentityLookup) Stop() {}
+
+// rebalance drops the rings of the previous members and hands over the grains
+// that now belong to another node.
+func (l *partitionIdentityLookup) rebalance() {
+	l.mu.Lock()
+	l.rings = make(map[string]*hashring.Ring)
+	l.mu.Unlock()
+
+	self := l.c.node.Name()
+	var moved []*grainBehavior
+	l.c.grainMu.RLock()
+	for id, b := range l.c.activations {
+		if node, ok := l.owner(id); ok && node != self {
+			moved = append(moved, b)
+		}
+	}
+	l.c.grainMu.RUnlock()
+
+	for _, b := range moved {
+		log.Println("cluster: hand over grain", b.id)
+		b.process.Stop()
+	}
+}
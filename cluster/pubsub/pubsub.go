@@ -0,0 +1,395 @@
+// Package pubsub publishes messages to the subscribers of a topic across the
+// cluster. Subscriptions are kept in a Store shared by the nodes, and messages
+// are sent in batches to a delivery actor on every node having subscribers,
+// which hands them to the local subscribers.
+package pubsub
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/actor"
+	"github.com/geniuscirno/go-actor/core"
+	"github.com/geniuscirno/go-actor/remote"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+// DeliveryName is the name of the delivery actor spawned on every node.
+const DeliveryName = "pubsub"
+
+type options struct {
+	batch int
+	queue int
+}
+
+func defaultOptions() options {
+	return options{
+		batch: 100,
+		queue: 1024,
+	}
+}
+
+type Option func(*options)
+
+// BatchSize sets how many messages are sent to a node at once.
+func BatchSize(n int) Option {
+	return func(o *options) {
+		o.batch = n
+	}
+}
+
+// QueueSize sets how many messages may wait to be sent to a node, Publish
+// blocks once the queue is full, and how many may wait to be handed to a
+// local subscriber, they are dropped once its queue is full.
+func QueueSize(n int) Option {
+	return func(o *options) {
+		o.queue = n
+	}
+}
+
+// PublishResult reports the outcome of PublishAck.
+type PublishResult struct {
+	Delivered int
+	// Failed are the subscribers the message could not be handed to, either
+	// because they died or because their node did not answer.
+	Failed []core.PID
+}
+
+// PubSub delivers published messages at most once: a message is dropped when
+// its node is unreachable or the queue of a subscriber is full. Every local
+// subscriber has a queue of QueueSize messages of its own, so a slow
+// subscriber does not hold up the others. PublishAck tells the publisher
+// which subscribers have been reached.
+type PubSub struct {
+	opts     options
+	node     *actor.Node
+	store    Store
+	delivery actor.Process
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	senders map[string]*nodeSender
+	queues  map[string]*subscriberQueue
+}
+
+// subscriberQueue holds the messages of a local subscriber, dropped is only
+// used by the delivery actor.
+type subscriberQueue struct {
+	ch      chan proto.Message
+	dropped int
+}
+
+// senderIdleTimeout is how long the sender of a node waits for messages
+// before it exits.
+const senderIdleTimeout = time.Minute
+
+// nodeSender batches the messages queued for a node, users are the publishers
+// about to queue a message, the sender does not exit before they have.
+type nodeSender struct {
+	ch    chan *Delivery
+	users int
+}
+
+func New(node *actor.Node, store Store, opt ...Option) (*PubSub, error) {
+	opts := defaultOptions()
+	for _, o := range opt {
+		o(&opts)
+	}
+	ps := &PubSub{
+		opts:    opts,
+		node:    node,
+		store:   store,
+		senders: make(map[string]*nodeSender),
+		queues:  make(map[string]*subscriberQueue),
+	}
+	ps.ctx, ps.cancel = context.WithCancel(context.Background())
+
+	delivery, err := node.SpawnActor(actor.ActorFunc(ps.receive), actor.Name(DeliveryName))
+	if err != nil {
+		return nil, err
+	}
+	ps.delivery = delivery
+	return ps, nil
+}
+
+// NewEtcd returns a PubSub keeping subscriptions under prefix in etcd, see
+// NewEtcdStore.
+func NewEtcd(node *actor.Node, client *clientv3.Client, prefix string, ttl time.Duration, opt ...Option) (*PubSub, error) {
+	store, err := NewEtcdStore(client, prefix, ttl)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := New(node, store, opt...)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return ps, nil
+}
+
+func (ps *PubSub) Close() {
+	ps.cancel()
+	ps.delivery.Stop()
+	ps.store.Close()
+}
+
+// Subscribe delivers the messages published to topic to pid. The subscription
+// of a process of this node is removed when the process dies.
+func (ps *PubSub) Subscribe(ctx context.Context, topic string, pid core.PID) error {
+	if err := ps.store.Subscribe(ctx, topic, pid); err != nil {
+		return err
+	}
+
+	if p, err := ps.node.Lookup(pid); err == nil {
+		go func() {
+			select {
+			case <-p.Context().Done():
+			case <-ps.ctx.Done():
+				return
+			}
+			ctx, cancel := context.WithTimeout(ps.ctx, time.Second*5)
+			defer cancel()
+			if err := ps.store.Unsubscribe(ctx, topic, pid); err != nil {
+				log.Printf("pubsub: unsubscribe %v from %s failed: %v\n", pid, topic, err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (ps *PubSub) Unsubscribe(ctx context.Context, topic string, pid core.PID) error {
+	return ps.store.Unsubscribe(ctx, topic, pid)
+}
+
+// Publish queues message for the subscribers of topic, it blocks only while
+// the queue of a node is full.
+func (ps *PubSub) Publish(ctx context.Context, topic string, message proto.Message) error {
+	deliveries, err := ps.deliveries(topic, message)
+	if err != nil {
+		return err
+	}
+	for node, d := range deliveries {
+		sender := ps.acquireSender(node)
+		select {
+		case sender.ch <- d:
+		case <-ctx.Done():
+			ps.releaseSender(sender)
+			return ctx.Err()
+		}
+		ps.releaseSender(sender)
+	}
+	return nil
+}
+
+// PublishAck sends message to the subscribers of topic without batching and
+// waits for every node to hand it to its subscribers.
+func (ps *PubSub) PublishAck(ctx context.Context, topic string, message proto.Message) (*PublishResult, error) {
+	deliveries, err := ps.deliveries(topic, message)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = &PublishResult{}
+	)
+	for node, d := range deliveries {
+		wg.Add(1)
+		go func(node string, d *Delivery) {
+			defer wg.Done()
+
+			reply, err := ps.node.Root.CallCtx(ctx, core.PID{Node: node, ID: DeliveryName}, d).Result()
+			ack, ok := reply.(*Ack)
+			if err != nil || !ok {
+				ack = &Ack{Failed: d.Subscribers}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Delivered += int(ack.Delivered)
+			for _, id := range ack.Failed {
+				result.Failed = append(result.Failed, core.PID{Node: node, ID: id})
+			}
+		}(node, d)
+	}
+	wg.Wait()
+	return result, nil
+}
+
+// deliveries groups the subscribers of topic by node.
+func (ps *PubSub) deliveries(topic string, message proto.Message) (map[string]*Delivery, error) {
+	data, err := remote.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make(map[string]*Delivery)
+	for _, pid := range ps.store.Subscribers(topic) {
+		d, ok := deliveries[pid.Node]
+		if !ok {
+			d = &Delivery{Topic: topic, Message: data}
+			deliveries[pid.Node] = d
+		}
+		d.Subscribers = append(d.Subscribers, pid.ID)
+	}
+	return deliveries, nil
+}
+
+func (ps *PubSub) acquireSender(node string) *nodeSender {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sender, ok := ps.senders[node]
+	if !ok {
+		sender = &nodeSender{ch: make(chan *Delivery, ps.opts.queue)}
+		ps.senders[node] = sender
+		go ps.send(node, sender)
+	}
+	sender.users++
+	return sender
+}
+
+func (ps *PubSub) releaseSender(sender *nodeSender) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sender.users--
+}
+
+// send sends the queued messages of a node, taking as many of them as are
+// waiting up to the batch size. It exits once the node has had no message for
+// senderIdleTimeout, e.g. after it left the cluster.
+func (ps *PubSub) send(node string, sender *nodeSender) {
+	to := core.PID{Node: node, ID: DeliveryName}
+	idle := time.NewTimer(senderIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		batch := &Batch{}
+		select {
+		case d := <-sender.ch:
+			batch.Deliveries = append(batch.Deliveries, d)
+		case <-idle.C:
+			ps.mu.Lock()
+			if sender.users == 0 && len(sender.ch) == 0 {
+				delete(ps.senders, node)
+				ps.mu.Unlock()
+				return
+			}
+			ps.mu.Unlock()
+			idle.Reset(senderIdleTimeout)
+			continue
+		case <-ps.ctx.Done():
+			return
+		}
+	fill:
+		for len(batch.Deliveries) < ps.opts.batch {
+			select {
+			case d := <-sender.ch:
+				batch.Deliveries = append(batch.Deliveries, d)
+			default:
+				break fill
+			}
+		}
+
+		if err := ps.delivery.Send(to, batch); err != nil {
+			log.Printf("pubsub: drop %d messages to %s: %v\n", len(batch.Deliveries), node, err)
+		}
+		if !idle.Stop() {
+			<-idle.C
+		}
+		idle.Reset(senderIdleTimeout)
+	}
+}
+
+func (ps *PubSub) receive(c actor.Context) {
+	switch msg := c.Message().(type) {
+	case *Batch:
+		for _, d := range msg.Deliveries {
+			ps.deliver(c, d)
+		}
+	case *Delivery:
+		c.Reply(ps.deliver(c, msg))
+	}
+}
+
+func (ps *PubSub) deliver(c actor.Context, d *Delivery) *Ack {
+	ack := &Ack{}
+	message, err := remote.Unmarshal(d.Message)
+	if err != nil {
+		log.Printf("pubsub: drop message to %s: %v\n", d.Topic, err)
+		ack.Failed = d.Subscribers
+		return ack
+	}
+
+	for _, id := range d.Subscribers {
+		queue, ok := ps.queue(core.PID{Node: c.Self().Node, ID: id})
+		if !ok {
+			ack.Failed = append(ack.Failed, id)
+			continue
+		}
+		select {
+		case queue.ch <- message:
+			ack.Delivered++
+		default:
+			// Logged once per queue size, a stuck subscriber would flood the
+			// log otherwise.
+			if queue.dropped++; queue.dropped%ps.opts.queue == 1 {
+				log.Printf("pubsub: drop message to %s for %s: queue full, %d dropped\n", d.Topic, id, queue.dropped)
+			}
+			ack.Failed = append(ack.Failed, id)
+		}
+	}
+	return ack
+}
+
+// queue returns the queue of a local subscriber, whose messages are sent by a
+// goroutine of its own until the subscriber dies.
+func (ps *PubSub) queue(pid core.PID) (*subscriberQueue, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if queue, ok := ps.queues[pid.ID]; ok {
+		return queue, true
+	}
+	p, err := ps.node.Lookup(pid)
+	if err != nil {
+		return nil, false
+	}
+	queue := &subscriberQueue{ch: make(chan proto.Message, ps.opts.queue)}
+	ps.queues[pid.ID] = queue
+	go ps.forward(p, queue)
+	return queue, true
+}
+
+func (ps *PubSub) forward(p core.Process, queue *subscriberQueue) {
+	ctx, cancel := context.WithCancel(ps.ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.Context().Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case message := <-queue.ch:
+			ps.delivery.SendCtx(ctx, p.Self(), message)
+		case <-ctx.Done():
+			ps.mu.Lock()
+			if ps.queues[p.Self().ID] == queue {
+				delete(ps.queues, p.Self().ID)
+			}
+			ps.mu.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/core"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// Store tracks the subscribers of every topic of the cluster.
+type Store interface {
+	Subscribe(ctx context.Context, topic string, pid core.PID) error
+	Unsubscribe(ctx context.Context, topic string, pid core.PID) error
+	// Subscribers returns the subscribers of topic known to this node, the
+	// subscriptions made on other nodes may be seen with a delay.
+	Subscribers(topic string) []core.PID
+	Close() error
+}
+
+// topics is the in memory view of the subscriptions shared by the stores.
+type topics struct {
+	mu     sync.RWMutex
+	topics map[string]map[core.PID]struct{}
+}
+
+func newTopics() *topics {
+	return &topics{topics: make(map[string]map[core.PID]struct{})}
+}
+
+func (t *topics) add(topic string, pid core.PID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	subs, ok := t.topics[topic]
+	if !ok {
+		subs = make(map[core.PID]struct{})
+		t.topics[topic] = subs
+	}
+	subs[pid] = struct{}{}
+}
+
+func (t *topics) remove(topic string, pid core.PID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.topics[topic], pid)
+	if len(t.topics[topic]) == 0 {
+		delete(t.topics, topic)
+	}
+}
+
+func (t *topics) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.topics = make(map[string]map[core.PID]struct{})
+}
+
+func (t *topics) subscribers(topic string) []core.PID {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	results := make([]core.PID, 0, len(t.topics[topic]))
+	for pid := range t.topics[topic] {
+		results = append(results, pid)
+	}
+	return results
+}
+
+type memoryStore struct {
+	*topics
+}
+
+// NewMemoryStore returns a Store for a single node.
+func NewMemoryStore() Store {
+	return &memoryStore{topics: newTopics()}
+}
+
+func (s *memoryStore) Subscribe(ctx context.Context, topic string, pid core.PID) error {
+	s.add(topic, pid)
+	return nil
+}
+
+func (s *memoryStore) Unsubscribe(ctx context.Context, topic string, pid core.PID) error {
+	s.remove(topic, pid)
+	return nil
+}
+
+func (s *memoryStore) Subscribers(topic string) []core.PID {
+	return s.subscribers(topic)
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+type subscription struct {
+	Topic string   `json:"topic"`
+	PID   core.PID `json:"pid"`
+}
+
+type etcdStore struct {
+	*topics
+	client *clientv3.Client
+	prefix string
+	ttl    time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	session *concurrency.Session
+	// local are the subscriptions made on this node by key, they are put again
+	// under a new session if the lease of the session is lost.
+	local map[string]subscription
+
+	// keys maps the watched keys to their subscription, delete events only
+	// carry the key.
+	keys map[string]subscription
+}
+
+// NewEtcdStore keeps subscriptions under prefix in etcd. They are attached to
+// a session lease of ttl, rounded up to whole seconds, so the subscriptions of
+// a node that died are removed ttl later. If this node loses its lease, e.g.
+// during a partition longer than ttl, its subscriptions are put again under a
+// new session.
+func NewEtcdStore(client *clientv3.Client, prefix string, ttl time.Duration) (Store, error) {
+	s := &etcdStore{
+		topics: newTopics(),
+		client: client,
+		prefix: strings.TrimSuffix(prefix, "/") + "/subscriptions/",
+		ttl:    ttl,
+		local:  make(map[string]subscription),
+		keys:   make(map[string]subscription),
+	}
+	session, err := s.newSession()
+	if err != nil {
+		return nil, err
+	}
+	s.session = session
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	go s.watch()
+	go s.keepSession()
+	return s, nil
+}
+
+func (s *etcdStore) newSession() (*concurrency.Session, error) {
+	return concurrency.NewSession(s.client, concurrency.WithTTL(int(math.Ceil(s.ttl.Seconds()))))
+}
+
+// keepSession opens a new session whenever the current one is lost and puts
+// the local subscriptions again under its lease.
+func (s *etcdStore) keepSession() {
+	for {
+		s.mu.Lock()
+		done := s.session.Done()
+		s.mu.Unlock()
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-done:
+		}
+		if s.ctx.Err() != nil {
+			// Closed by Close.
+			return
+		}
+		log.Println("pubsub: session lost, subscribing again")
+
+		var session *concurrency.Session
+		for {
+			var err error
+			if session, err = s.newSession(); err == nil {
+				break
+			}
+			log.Println("pubsub: open session failed:", err)
+			s.sleep(time.Second)
+			if s.ctx.Err() != nil {
+				return
+			}
+		}
+
+		s.mu.Lock()
+		if s.ctx.Err() != nil {
+			s.mu.Unlock()
+			session.Close()
+			return
+		}
+		s.session.Close()
+		s.session = session
+		local := make(map[string]subscription, len(s.local))
+		for key, sub := range s.local {
+			local[key] = sub
+		}
+		s.mu.Unlock()
+
+		for key, sub := range local {
+			if err := s.put(s.ctx, key, sub, session); err != nil {
+				log.Printf("pubsub: subscribe %v to %s again failed: %v\n", sub.PID, sub.Topic, err)
+			}
+		}
+	}
+}
+
+func (s *etcdStore) put(ctx context.Context, key string, sub subscription, session *concurrency.Session) error {
+	b, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Put(ctx, key, string(b), clientv3.WithLease(session.Lease()))
+	return err
+}
+
+func (s *etcdStore) key(topic string, pid core.PID) string {
+	return s.prefix + url.PathEscape(topic) + "/" + pid.String()
+}
+
+func (s *etcdStore) Subscribe(ctx context.Context, topic string, pid core.PID) error {
+	key, sub := s.key(topic, pid), subscription{Topic: topic, PID: pid}
+
+	// Recorded first, so that a session renewed meanwhile puts it too.
+	s.mu.Lock()
+	s.local[key] = sub
+	session := s.session
+	s.mu.Unlock()
+
+	if err := s.put(ctx, key, sub, session); err != nil {
+		s.mu.Lock()
+		delete(s.local, key)
+		s.mu.Unlock()
+		return err
+	}
+	s.add(topic, pid)
+	return nil
+}
+
+func (s *etcdStore) Unsubscribe(ctx context.Context, topic string, pid core.PID) error {
+	key := s.key(topic, pid)
+	s.mu.Lock()
+	delete(s.local, key)
+	s.mu.Unlock()
+
+	if _, err := s.client.Delete(ctx, key); err != nil {
+		return err
+	}
+	s.remove(topic, pid)
+	return nil
+}
+
+func (s *etcdStore) Subscribers(topic string) []core.PID {
+	return s.subscribers(topic)
+}
+
+func (s *etcdStore) Close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.session.Close()
+}
+
+// watch keeps the local view in sync with etcd, it reloads every
+// subscription whenever the watch has to be restarted.
+func (s *etcdStore) watch() {
+	for s.ctx.Err() == nil {
+		rev, err := s.load()
+		if err != nil {
+			log.Println("pubsub: load subscriptions failed:", err)
+			s.sleep(time.Second)
+			continue
+		}
+
+		wch := s.client.Watch(s.ctx, s.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+		for resp := range wch {
+			if err := resp.Err(); err != nil {
+				log.Println("pubsub: watch subscriptions failed:", err)
+				break
+			}
+			for _, event := range resp.Events {
+				key := string(event.Kv.Key)
+				switch event.Type {
+				case clientv3.EventTypePut:
+					sub := subscription{}
+					if err := json.Unmarshal(event.Kv.Value, &sub); err != nil {
+						continue
+					}
+					s.keys[key] = sub
+					s.add(sub.Topic, sub.PID)
+				case clientv3.EventTypeDelete:
+					if sub, ok := s.keys[key]; ok {
+						delete(s.keys, key)
+						s.remove(sub.Topic, sub.PID)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (s *etcdStore) load() (int64, error) {
+	resp, err := s.client.Get(s.ctx, s.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	s.reset()
+	s.keys = make(map[string]subscription, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		sub := subscription{}
+		if err := json.Unmarshal(kv.Value, &sub); err != nil {
+			continue
+		}
+		s.keys[string(kv.Key)] = sub
+		s.add(sub.Topic, sub.PID)
+	}
+	return resp.Header.Revision, nil
+}
+
+func (s *etcdStore) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-s.ctx.Done():
+	case <-t.C:
+	}
+}
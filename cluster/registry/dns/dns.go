@@ -0,0 +1,239 @@
+// Package dns implements registry.Discovery by resolving DNS records, such
+// as those of a Kubernetes headless service: the pods of a StatefulSet find
+// each other without etcd.
+//
+//	// _grpc._tcp.game.default.svc.cluster.local
+//	d := dns.New("game.default.svc.cluster.local", dns.SRV("grpc", "tcp"), dns.NodeName(dns.Hostname))
+package dns
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geniuscirno/go-actor/cluster/registry"
+)
+
+// Resolver resolves the records, net.DefaultResolver by default.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type options struct {
+	resolver   Resolver
+	interval   time.Duration
+	srv        bool
+	service    string
+	proto      string
+	port       int
+	nodeName   func(host string) string
+	kinds      []string
+	attributes map[string]string
+}
+
+func defaultOptions() options {
+	return options{
+		resolver: net.DefaultResolver,
+		interval: time.Second * 10,
+		nodeName: func(host string) string { return host },
+	}
+}
+
+type Option func(*options)
+
+// WithResolver sets the resolver of the records, such as a stub in tests.
+func WithResolver(r Resolver) Option {
+	return func(o *options) {
+		o.resolver = r
+	}
+}
+
+// Interval sets how often the records are resolved again.
+func Interval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// SRV resolves the SRV records _service._proto.name, which give the host and
+// the port of every node. Empty service and proto resolve name itself.
+func SRV(service, proto string) Option {
+	return func(o *options) {
+		o.srv = true
+		o.service = service
+		o.proto = proto
+	}
+}
+
+// Port sets the port of the nodes resolved from the A/AAAA records of name,
+// the records of a headless service without SRV.
+func Port(port int) Option {
+	return func(o *options) {
+		o.port = port
+	}
+}
+
+// NodeName sets the name of the node at host, the target of an SRV record or
+// the address of an A/AAAA record. It must match the name the node is started
+// with, host itself by default.
+func NodeName(fn func(host string) string) Option {
+	return func(o *options) {
+		o.nodeName = fn
+	}
+}
+
+// Hostname names a node by the first label of its host, the name of the pod
+// for the SRV targets of a StatefulSet (web-0.web.default.svc.cluster.local).
+func Hostname(host string) string {
+	host, _, _ = strings.Cut(strings.TrimSuffix(host, "."), ".")
+	return host
+}
+
+// Kinds sets the kinds of grains hosted by the resolved nodes.
+func Kinds(kinds ...string) Option {
+	return func(o *options) {
+		o.kinds = kinds
+	}
+}
+
+// Attributes sets the attributes of the resolved nodes.
+func Attributes(attrs map[string]string) Option {
+	return func(o *options) {
+		o.attributes = attrs
+	}
+}
+
+type Discovery struct {
+	name string
+	opts options
+}
+
+// New returns a Discovery of the nodes resolved from the records of name.
+func New(name string, opt ...Option) *Discovery {
+	opts := defaultOptions()
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Discovery{name: name, opts: opts}
+}
+
+func (d *Discovery) lookup(ctx context.Context) ([]*registry.Node, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	var nodes []*registry.Node
+	if d.opts.srv {
+		_, srvs, err := d.opts.resolver.LookupSRV(ctx, d.opts.service, d.opts.proto, d.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			nodes = append(nodes, d.node(host, net.JoinHostPort(host, strconv.Itoa(int(srv.Port)))))
+		}
+	} else {
+		if d.opts.port == 0 {
+			return nil, errors.New("dns: no port for A records")
+		}
+		addrs, err := d.opts.resolver.LookupHost(ctx, d.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			nodes = append(nodes, d.node(addr, net.JoinHostPort(addr, strconv.Itoa(d.opts.port))))
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes, nil
+}
+
+func (d *Discovery) node(host, addr string) *registry.Node {
+	return &registry.Node{
+		Name:       d.opts.nodeName(host),
+		Address:    addr,
+		Kinds:      d.opts.kinds,
+		Attributes: d.opts.attributes,
+	}
+}
+
+func (d *Discovery) Watch(ctx context.Context) (registry.Watcher, error) {
+	w := &watcher{d: d, first: true}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	return w, nil
+}
+
+type watcher struct {
+	d      *Discovery
+	ctx    context.Context
+	cancel context.CancelFunc
+	nodes  []*registry.Node
+	first  bool
+	failed bool
+}
+
+// resolve returns the nodes resolved, or the last nodes if the resolution
+// fails: no record may exist until the first pod is ready.
+func (w *watcher) resolve() []*registry.Node {
+	nodes, err := w.d.lookup(w.ctx)
+	if err != nil {
+		if !w.failed && w.ctx.Err() == nil {
+			log.Printf("dns: resolve %s failed: %v\n", w.d.name, err)
+		}
+		w.failed = true
+		return w.nodes
+	}
+	w.failed = false
+	return nodes
+}
+
+func (w *watcher) Next() ([]*registry.Node, error) {
+	if w.first {
+		w.first = false
+		w.nodes = w.resolve()
+		return w.nodes, nil
+	}
+
+	ticker := time.NewTicker(w.d.opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case <-ticker.C:
+		}
+
+		nodes := w.resolve()
+		if equal(nodes, w.nodes) {
+			continue
+		}
+		w.nodes = nodes
+		return nodes, nil
+	}
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+	return nil
+}
+
+// equal reports whether a and b, sorted by name, are the same nodes.
+func equal(a, b []*registry.Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Address != b[i].Address {
+			return false
+		}
+	}
+	return true
+}
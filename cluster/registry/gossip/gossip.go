@@ -0,0 +1,675 @@
+// Package gossip implements registry.Registrar and registry.Discovery with a
+// SWIM membership protocol over UDP, for clusters without etcd.
+//
+// Every ProbeInterval, a node pings a member and waits ProbeTimeout for its
+// ack. Without an ack, it asks IndirectChecks other members to ping it, and
+// suspects the member if none of them gets an ack either. A suspected member
+// refutes the suspicion by gossiping a greater incarnation, and is declared
+// dead after SuspicionTimeout otherwise. The changes of the members are
+// piggybacked on the pings and acks.
+//
+// A node joins the cluster through its seeds, the gossip addresses of some
+// members:
+//
+//	g, err := gossip.New(":7946", gossip.Seeds("10.0.0.1:7946", "10.0.0.2:7946"))
+//	c, err := cluster.NewCluster(node, backend, cluster.Registrar(g), cluster.Discovery(g))
+package gossip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/cluster/registry"
+)
+
+const maxPacketSize = 65507
+
+type options struct {
+	seeds            []string
+	advertiseAddr    string
+	probeInterval    time.Duration
+	probeTimeout     time.Duration
+	suspicionTimeout time.Duration
+	indirectChecks   int
+	deadTimeout      time.Duration
+	retransmitMult   int
+}
+
+func defaultOptions() options {
+	return options{
+		probeInterval:    time.Second,
+		probeTimeout:     time.Millisecond * 500,
+		suspicionTimeout: time.Second * 5,
+		indirectChecks:   3,
+		deadTimeout:      time.Minute,
+		retransmitMult:   4,
+	}
+}
+
+type Option func(*options)
+
+// Seeds sets the gossip addresses of the members to join the cluster through.
+func Seeds(addrs ...string) Option {
+	return func(o *options) {
+		o.seeds = append(o.seeds, addrs...)
+	}
+}
+
+// AdvertiseAddr sets the gossip address the other members reach this node
+// at, by default the host of the registered node with the port listened on.
+func AdvertiseAddr(addr string) Option {
+	return func(o *options) {
+		o.advertiseAddr = addr
+	}
+}
+
+func ProbeInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.probeInterval = d
+	}
+}
+
+// ProbeTimeout sets how long a ping waits for its ack before the member is
+// checked indirectly, it must be shorter than the probe interval.
+func ProbeTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.probeTimeout = d
+	}
+}
+
+// SuspicionTimeout sets how long a member is suspected before it is declared
+// dead.
+func SuspicionTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.suspicionTimeout = d
+	}
+}
+
+// IndirectChecks sets how many members are asked to ping a member that has
+// not answered a ping.
+func IndirectChecks(n int) Option {
+	return func(o *options) {
+		o.indirectChecks = n
+	}
+}
+
+type member struct {
+	name        string
+	addr        string
+	node        *registry.Node
+	incarnation uint64
+	state       state
+	// suspicion declares the member dead once it expires.
+	suspicion *time.Timer
+	deadAt    time.Time
+}
+
+func (m *member) update() update {
+	return update{State: m.state, Name: m.name, Incarnation: m.incarnation, Addr: m.addr, Node: m.node}
+}
+
+// broadcast is an update piggybacked on the next messages until it has been
+// sent transmits times.
+type broadcast struct {
+	update    update
+	transmits int
+}
+
+type Gossip struct {
+	opts options
+	conn net.PacketConn
+
+	mu         sync.Mutex
+	self       *member
+	members    map[string]*member
+	broadcasts []*broadcast
+	probes     []string
+	seq        uint64
+	acks       map[uint64]func()
+	changed    chan struct{}
+	leaving    bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a Gossip listening for the messages of the members on the UDP
+// address bind, the node joins the cluster once it is registered.
+func New(bind string, opt ...Option) (*Gossip, error) {
+	opts := defaultOptions()
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.probeTimeout <= 0 || opts.probeInterval <= opts.probeTimeout {
+		// The indirect probes wait for the rest of the interval.
+		return nil, errors.New("gossip: probe timeout must be positive and shorter than the probe interval")
+	}
+	conn, err := net.ListenPacket("udp", bind)
+	if err != nil {
+		return nil, err
+	}
+	g := &Gossip{
+		opts:    opts,
+		conn:    conn,
+		members: make(map[string]*member),
+		acks:    make(map[uint64]func()),
+		changed: make(chan struct{}),
+	}
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	return g, nil
+}
+
+// Addr returns the UDP address listened on.
+func (g *Gossip) Addr() string {
+	return g.conn.LocalAddr().String()
+}
+
+func (g *Gossip) advertiseAddr(node *registry.Node) string {
+	if g.opts.advertiseAddr != "" {
+		return g.opts.advertiseAddr
+	}
+	_, port, _ := net.SplitHostPort(g.Addr())
+	host, _, err := net.SplitHostPort(node.Address)
+	if err != nil {
+		host = node.Address
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Register joins the cluster with node as the metadata of this member.
+func (g *Gossip) Register(ctx context.Context, node *registry.Node) error {
+	g.mu.Lock()
+	if g.self != nil {
+		g.mu.Unlock()
+		return errors.New("gossip: already registered")
+	}
+	// Starting from the time, the incarnation of a restarted node supersedes
+	// the one it had before.
+	g.self = &member{
+		name:        node.Name,
+		addr:        g.advertiseAddr(node),
+		node:        node,
+		incarnation: uint64(time.Now().UnixNano()),
+		state:       stateAlive,
+	}
+	g.notify()
+	g.mu.Unlock()
+
+	g.wg.Add(2)
+	go func() {
+		defer g.wg.Done()
+		g.receive()
+	}()
+	go func() {
+		defer g.wg.Done()
+		g.probe()
+	}()
+
+	g.join()
+	return nil
+}
+
+// Deregister gossips that this node is leaving and stops the protocol.
+func (g *Gossip) Deregister(ctx context.Context, node *registry.Node) error {
+	g.mu.Lock()
+	if g.self == nil || g.leaving {
+		g.mu.Unlock()
+		return nil
+	}
+	g.leaving = true
+	g.self.incarnation++
+	g.self.state = stateDead
+	leave := message{Type: typeGossip, Updates: []update{g.self.update()}}
+	var addrs []string
+	for _, m := range g.members {
+		if m.state != stateDead {
+			addrs = append(addrs, m.addr)
+		}
+	}
+	g.mu.Unlock()
+
+	for _, addr := range addrs {
+		g.send(addr, leave)
+	}
+	g.cancel()
+	g.conn.Close()
+	g.wg.Wait()
+	return nil
+}
+
+// KeepAlive blocks until ctx is done or the node is deregistered, the
+// protocol keeps the node alive meanwhile.
+func (g *Gossip) KeepAlive(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+	case <-g.ctx.Done():
+	}
+	return nil
+}
+
+func (g *Gossip) Watch(ctx context.Context) (registry.Watcher, error) {
+	w := &watcher{g: g}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	return w, nil
+}
+
+// notify wakes the watchers up, g.mu must be held.
+func (g *Gossip) notify() {
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// nodes returns the nodes of the members not known to be dead, and a channel
+// closed when they change.
+func (g *Gossip) nodes() ([]*registry.Node, <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var nodes []*registry.Node
+	if g.self != nil && !g.leaving {
+		nodes = append(nodes, g.self.node)
+	}
+	for _, m := range g.members {
+		if m.state != stateDead && m.node != nil {
+			nodes = append(nodes, m.node)
+		}
+	}
+	return nodes, g.changed
+}
+
+func (g *Gossip) join() {
+	g.mu.Lock()
+	join := message{Type: typeJoin, Updates: []update{g.self.update()}}
+	self := g.self.addr
+	g.mu.Unlock()
+
+	for _, seed := range g.opts.seeds {
+		if seed != self {
+			g.send(seed, join)
+		}
+	}
+}
+
+func (g *Gossip) probe() {
+	ticker := time.NewTicker(g.opts.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		target, ok := g.nextProbe()
+		if !ok {
+			// Alone, the seeds may have started since.
+			g.join()
+			continue
+		}
+		g.probeMember(target)
+		g.reap()
+	}
+}
+
+// nextProbe returns the next member to probe, going through the members in
+// a random order.
+func (g *Gossip) nextProbe() (*member, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for {
+		if len(g.probes) == 0 {
+			for name, m := range g.members {
+				if m.state != stateDead {
+					g.probes = append(g.probes, name)
+				}
+			}
+			if len(g.probes) == 0 {
+				return nil, false
+			}
+			rand.Shuffle(len(g.probes), func(i, j int) {
+				g.probes[i], g.probes[j] = g.probes[j], g.probes[i]
+			})
+		}
+
+		name := g.probes[0]
+		g.probes = g.probes[1:]
+		if m, ok := g.members[name]; ok && m.state != stateDead {
+			target := *m
+			return &target, true
+		}
+	}
+}
+
+func (g *Gossip) probeMember(target *member) {
+	seq, acked := g.expectAck()
+	g.send(target.addr, message{Type: typePing, Seq: seq})
+	if g.wait(acked, g.opts.probeTimeout) || g.ctx.Err() != nil {
+		return
+	}
+
+	for _, addr := range g.helpers(target.name) {
+		g.send(addr, message{Type: typePingReq, Seq: seq, Target: target.addr})
+	}
+	if g.wait(acked, g.opts.probeInterval-g.opts.probeTimeout) || g.ctx.Err() != nil {
+		// Stopped, the target is not to be suspected for it.
+		return
+	}
+
+	g.mu.Lock()
+	delete(g.acks, seq)
+	g.mu.Unlock()
+	g.apply(update{State: stateSuspect, Name: target.name, Incarnation: target.incarnation})
+}
+
+// expectAck returns a sequence number for a ping and a channel closed when
+// its ack is received.
+func (g *Gossip) expectAck() (uint64, <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.seq++
+	seq := g.seq
+	acked := make(chan struct{})
+	g.acks[seq] = func() { close(acked) }
+	return seq, acked
+}
+
+func (g *Gossip) wait(acked <-chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-acked:
+		return true
+	case <-g.ctx.Done():
+		return false
+	case <-t.C:
+		return false
+	}
+}
+
+// helpers returns the addresses of random members to ping name indirectly.
+func (g *Gossip) helpers(name string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var addrs []string
+	for _, m := range g.members {
+		if m.name != name && m.state == stateAlive {
+			addrs = append(addrs, m.addr)
+		}
+	}
+	rand.Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+	if len(addrs) > g.opts.indirectChecks {
+		addrs = addrs[:g.opts.indirectChecks]
+	}
+	return addrs
+}
+
+// reap forgets the members dead for long enough that their updates are not
+// gossiped anymore.
+func (g *Gossip) reap() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for name, m := range g.members {
+		if m.state == stateDead && time.Since(m.deadAt) > g.opts.deadTimeout {
+			delete(g.members, name)
+		}
+	}
+}
+
+func (g *Gossip) receive() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := g.conn.ReadFrom(buf)
+		if err != nil {
+			if g.ctx.Err() == nil {
+				log.Println("gossip: read failed:", err)
+			}
+			return
+		}
+
+		var msg message
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			log.Printf("gossip: bad message from %v: %v\n", addr, err)
+			continue
+		}
+		g.handle(addr.String(), msg)
+	}
+}
+
+func (g *Gossip) handle(from string, msg message) {
+	for _, u := range msg.Updates {
+		g.apply(u)
+	}
+
+	switch msg.Type {
+	case typePing:
+		g.send(from, message{Type: typeAck, Seq: msg.Seq})
+	case typePingReq:
+		seq, acked := g.expectAck()
+		g.send(msg.Target, message{Type: typePing, Seq: seq})
+		go func() {
+			if g.wait(acked, g.opts.probeTimeout) {
+				g.send(from, message{Type: typeAck, Seq: msg.Seq})
+				return
+			}
+			g.mu.Lock()
+			delete(g.acks, seq)
+			g.mu.Unlock()
+		}()
+	case typeAck:
+		g.mu.Lock()
+		acked, ok := g.acks[msg.Seq]
+		delete(g.acks, msg.Seq)
+		g.mu.Unlock()
+		if ok {
+			acked()
+		}
+	case typeJoin:
+		g.mu.Lock()
+		updates := []update{g.self.update()}
+		for _, m := range g.members {
+			updates = append(updates, m.update())
+		}
+		g.mu.Unlock()
+		g.send(from, message{Type: typeSync, Updates: updates})
+	}
+}
+
+// apply merges an update into the state of the members.
+func (g *Gossip) apply(u update) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.self == nil {
+		return
+	}
+	switch u.State {
+	case stateAlive, stateSuspect, stateDead:
+	default:
+		// Sent by a peer, an unknown state must not be merged.
+		return
+	}
+	if u.Name == g.self.name {
+		g.refute(u)
+		return
+	}
+
+	m, ok := g.members[u.Name]
+	switch u.State {
+	case stateAlive:
+		if ok && u.Incarnation <= m.incarnation {
+			return
+		}
+		if !ok {
+			m = &member{name: u.Name}
+			g.members[u.Name] = m
+			log.Printf("gossip: %s joined\n", u.Name)
+		} else if m.state == stateDead {
+			log.Printf("gossip: %s rejoined\n", u.Name)
+		}
+		m.stopSuspicion()
+		m.addr, m.node, m.incarnation, m.state = u.Addr, u.Node, u.Incarnation, stateAlive
+		g.notify()
+	case stateSuspect:
+		if !ok || m.state == stateDead || u.Incarnation < m.incarnation ||
+			(m.state == stateSuspect && u.Incarnation == m.incarnation) {
+			return
+		}
+		log.Printf("gossip: %s suspected\n", u.Name)
+		m.stopSuspicion()
+		m.incarnation, m.state = u.Incarnation, stateSuspect
+		name, incarnation := m.name, m.incarnation
+		m.suspicion = time.AfterFunc(g.opts.suspicionTimeout, func() {
+			g.apply(update{State: stateDead, Name: name, Incarnation: incarnation})
+		})
+	case stateDead:
+		if !ok || m.state == stateDead || u.Incarnation < m.incarnation {
+			return
+		}
+		log.Printf("gossip: %s is dead\n", u.Name)
+		m.stopSuspicion()
+		m.incarnation, m.state, m.deadAt = u.Incarnation, stateDead, time.Now()
+		g.notify()
+	}
+	if m != nil {
+		g.enqueue(m.update())
+	}
+}
+
+// refute gossips a greater incarnation of this node when it is suspected or
+// declared dead. g.mu must be held.
+func (g *Gossip) refute(u update) {
+	if g.leaving || u.Incarnation < g.self.incarnation || (u.State == stateAlive && u.Incarnation == g.self.incarnation) {
+		return
+	}
+	g.self.incarnation = u.Incarnation + 1
+	g.enqueue(g.self.update())
+}
+
+func (m *member) stopSuspicion() {
+	if m.suspicion != nil {
+		m.suspicion.Stop()
+		m.suspicion = nil
+	}
+}
+
+// enqueue queues u to be piggybacked, replacing the update of the same member
+// not sent enough yet. g.mu must be held.
+func (g *Gossip) enqueue(u update) {
+	for i, b := range g.broadcasts {
+		if b.update.Name == u.Name {
+			g.broadcasts = append(g.broadcasts[:i], g.broadcasts[i+1:]...)
+			break
+		}
+	}
+	g.broadcasts = append(g.broadcasts, &broadcast{update: u})
+}
+
+// piggyback returns the updates to send with a message, the least sent ones
+// first.
+func (g *Gossip) piggyback() []update {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	limit := g.opts.retransmitMult * int(math.Ceil(math.Log10(float64(len(g.members)+2))))
+	var updates []update
+	kept := g.broadcasts[:0]
+	for _, b := range g.broadcasts {
+		if len(updates) < 16 {
+			updates = append(updates, b.update)
+			b.transmits++
+		}
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	g.broadcasts = kept
+	return updates
+}
+
+func (g *Gossip) send(addr string, msg message) {
+	if msg.Type != typeSync && msg.Type != typeGossip {
+		msg.Updates = append(msg.Updates, g.piggyback()...)
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("gossip: marshal message failed:", err)
+		return
+	}
+	for len(b) > maxPacketSize {
+		if len(msg.Updates) <= 1 {
+			log.Printf("gossip: drop message to %s, %d bytes do not fit in a packet\n", addr, len(b))
+			return
+		}
+		half := len(msg.Updates) / 2
+		if msg.Type == typeSync || msg.Type == typeGossip {
+			// Made of updates only, the second half goes in another
+			// message.
+			rest := msg
+			rest.Updates = msg.Updates[half:]
+			g.send(addr, rest)
+		}
+		// Otherwise the piggybacked updates at the end are left out, the
+		// other members piggyback them too.
+		msg.Updates = msg.Updates[:half]
+		if b, err = json.Marshal(msg); err != nil {
+			log.Println("gossip: marshal message failed:", err)
+			return
+		}
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		log.Printf("gossip: resolve %s failed: %v\n", addr, err)
+		return
+	}
+	if _, err := g.conn.WriteTo(b, udpAddr); err != nil && g.ctx.Err() == nil {
+		log.Printf("gossip: send to %s failed: %v\n", addr, err)
+	}
+}
+
+// watcher keeps the channel returned with the last nodes, so that a change
+// between two calls to Next is not missed.
+type watcher struct {
+	g       *Gossip
+	ctx     context.Context
+	cancel  context.CancelFunc
+	changed <-chan struct{}
+}
+
+func (w *watcher) Next() ([]*registry.Node, error) {
+	if w.changed == nil {
+		var nodes []*registry.Node
+		nodes, w.changed = w.g.nodes()
+		return nodes, nil
+	}
+
+	select {
+	case <-w.ctx.Done():
+		return nil, w.ctx.Err()
+	case <-w.g.ctx.Done():
+		return nil, errors.New("gossip: deregistered")
+	case <-w.changed:
+		var nodes []*registry.Node
+		nodes, w.changed = w.g.nodes()
+		return nodes, nil
+	}
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+	return nil
+}
@@ -0,0 +1,58 @@
+package gossip
+
+import (
+	"github.com/geniuscirno/go-actor/cluster/registry"
+)
+
+type messageType string
+
+const (
+	// ping is answered with an ack.
+	typePing messageType = "ping"
+	// pingReq asks the receiver to ping Target and to forward its ack.
+	typePingReq messageType = "ping-req"
+	typeAck     messageType = "ack"
+	// join is answered with a sync holding the state of every member.
+	typeJoin messageType = "join"
+	typeSync messageType = "sync"
+	// gossip only carries updates.
+	typeGossip messageType = "gossip"
+)
+
+// message is sent as JSON in a UDP datagram, every message carries some of
+// the pending updates of the members.
+type message struct {
+	Type    messageType `json:"type"`
+	Seq     uint64      `json:"seq,omitempty"`
+	Target  string      `json:"target,omitempty"`
+	Updates []update    `json:"updates,omitempty"`
+}
+
+type state int
+
+const (
+	stateAlive state = iota
+	stateSuspect
+	stateDead
+)
+
+func (s state) String() string {
+	switch s {
+	case stateAlive:
+		return "alive"
+	case stateSuspect:
+		return "suspect"
+	default:
+		return "dead"
+	}
+}
+
+// update is the state of a member at an incarnation. A member only changes
+// its incarnation itself, to refute that it is suspected.
+type update struct {
+	State       state          `json:"state"`
+	Name        string         `json:"name"`
+	Incarnation uint64         `json:"incarnation"`
+	Addr        string         `json:"addr,omitempty"`
+	Node        *registry.Node `json:"node,omitempty"`
+}
@@ -2,9 +2,14 @@ package registry
 
 import "context"
 
+// Node is a node of the cluster as advertised by the registry. Kinds are the
+// kinds of grains the node hosts, a node without kinds hosts every kind.
+// Attributes are free-form, such as the role of the node.
 type Node struct {
-	Name    string `json:"name"`
-	Address string `json:"address"`
+	Name       string            `json:"name"`
+	Address    string            `json:"address"`
+	Kinds      []string          `json:"kinds,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 type Registrar interface {
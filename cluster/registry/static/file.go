@@ -0,0 +1,139 @@
+package static
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/geniuscirno/go-actor/cluster/registry"
+	"gopkg.in/yaml.v2"
+)
+
+type options struct {
+	interval time.Duration
+}
+
+func defaultOptions() options {
+	return options{
+		interval: time.Second * 5,
+	}
+}
+
+type Option func(*options)
+
+// Interval sets how often the file is read for changes.
+func Interval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// FileDiscovery is a Discovery of the nodes listed in a JSON or YAML file,
+// read again every Interval. A file ending in .json is read as JSON, any
+// other as YAML:
+//
+//	# nodes.yaml
+//	- name: node1
+//	  address: 10.0.0.1:9700
+//	  kinds: [player]
+//	- name: node2
+//	  address: 10.0.0.2:9700
+//	  attributes:
+//	    role: gateway
+type FileDiscovery struct {
+	path string
+	opts options
+}
+
+// NewFile returns a Discovery of the nodes listed in the file at path.
+func NewFile(path string, opt ...Option) *FileDiscovery {
+	opts := defaultOptions()
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &FileDiscovery{path: path, opts: opts}
+}
+
+func (d *FileDiscovery) read() ([]byte, []*registry.Node, error) {
+	b, err := os.ReadFile(d.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var nodes []*registry.Node
+	if strings.EqualFold(filepath.Ext(d.path), ".json") {
+		err = json.Unmarshal(b, &nodes)
+	} else {
+		err = yaml.Unmarshal(b, &nodes)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("static: parse %s: %w", d.path, err)
+	}
+	return b, nodes, nil
+}
+
+// Watch fails if the file cannot be read, later failures are logged and the
+// last nodes read are kept.
+func (d *FileDiscovery) Watch(ctx context.Context) (registry.Watcher, error) {
+	b, nodes, err := d.read()
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWatcher{d: d, content: b, nodes: nodes, first: true}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	return w, nil
+}
+
+type fileWatcher struct {
+	d       *FileDiscovery
+	ctx     context.Context
+	cancel  context.CancelFunc
+	content []byte
+	nodes   []*registry.Node
+	first   bool
+	failed  bool
+}
+
+func (w *fileWatcher) Next() ([]*registry.Node, error) {
+	if w.first {
+		w.first = false
+		return w.nodes, nil
+	}
+
+	ticker := time.NewTicker(w.d.opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case <-ticker.C:
+		}
+
+		b, nodes, err := w.d.read()
+		if err != nil {
+			// Logged once until the file is read again, it may be in the
+			// middle of being replaced.
+			if !w.failed {
+				log.Println("static: read nodes failed:", err)
+				w.failed = true
+			}
+			continue
+		}
+		w.failed = false
+		if bytes.Equal(b, w.content) {
+			continue
+		}
+		w.content, w.nodes = b, nodes
+		return nodes, nil
+	}
+}
+
+func (w *fileWatcher) Stop() error {
+	w.cancel()
+	return nil
+}
@@ -0,0 +1,45 @@
+// Package static implements registry.Discovery with a fixed list of nodes,
+// given in code or read from a file, for clusters without etcd.
+package static
+
+import (
+	"context"
+
+	"github.com/geniuscirno/go-actor/cluster/registry"
+)
+
+type Discovery struct {
+	nodes []*registry.Node
+}
+
+// New returns a Discovery of nodes, they never change.
+func New(nodes ...*registry.Node) *Discovery {
+	return &Discovery{nodes: nodes}
+}
+
+func (d *Discovery) Watch(ctx context.Context) (registry.Watcher, error) {
+	w := &watcher{nodes: d.nodes, first: true}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	return w, nil
+}
+
+type watcher struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	nodes  []*registry.Node
+	first  bool
+}
+
+func (w *watcher) Next() ([]*registry.Node, error) {
+	if w.first {
+		w.first = false
+		return w.nodes, nil
+	}
+	<-w.ctx.Done()
+	return nil, w.ctx.Err()
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+	return nil
+}
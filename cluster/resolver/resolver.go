@@ -7,8 +7,10 @@ import (
 )
 
 type Address struct {
-	Addr string
-	Name string
+	Addr       string
+	Name       string
+	Kinds      []string
+	Attributes map[string]string
 }
 
 type State struct {
@@ -55,7 +57,7 @@ func (r *resolver) watch() {
 
 		addrs := make([]Address, 0, len(nodes))
 		for _, node := range nodes {
-			addrs = append(addrs, Address{Name: node.Name, Addr: node.Address})
+			addrs = append(addrs, Address{Name: node.Name, Addr: node.Address, Kinds: node.Kinds, Attributes: node.Attributes})
 		}
 		r.c.UpdateState(State{Addresses: addrs})
 	}
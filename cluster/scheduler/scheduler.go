@@ -0,0 +1,265 @@
+// Package scheduler sends delayed messages that survive node restarts. Pending
+// messages are kept in a Store shared by the cluster, and only the node
+// elected by a Leader fires them.
+//
+// A message is delivered at least once, not exactly once: sending it and
+// removing it from the store cannot happen atomically, so a message may be
+// sent again after a crash or a lost leadership. Receivers that must handle it
+// once drop the duplicates by HeaderMessageID.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/core"
+	"github.com/geniuscirno/go-actor/remote"
+	"github.com/google/uuid"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// HeaderMessageID carries the id of a scheduled message, the same for all its
+// deliveries.
+const HeaderMessageID = core.HeaderIdempotencyKey
+
+type options struct {
+	interval    time.Duration
+	batch       int
+	maxAttempts int
+	retryDelay  time.Duration
+}
+
+func defaultOptions() options {
+	return options{
+		interval:    time.Second,
+		batch:       100,
+		maxAttempts: 5,
+		retryDelay:  time.Second * 5,
+	}
+}
+
+type Option func(*options)
+
+// PollInterval sets how often the leader looks for due messages, it bounds
+// how late a message may fire.
+func PollInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// MaxAttempts sets how many times delivery of a message is tried before it is
+// dropped.
+func MaxAttempts(n int) Option {
+	return func(o *options) {
+		o.maxAttempts = n
+	}
+}
+
+func RetryDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.retryDelay = d
+	}
+}
+
+// Scheduler fires every stored message at least once: due entries are removed
+// from the store only after they have been sent, so a leader crashing in
+// between, or losing its leadership, sends the message again rather than
+// losing it. A message whose delivery fails is stored again and retried
+// after RetryDelay. Every attempt carries the id of the message in the
+// HeaderMessageID header, for receivers to drop duplicates, e.g. with
+// actor.IdempotencyMiddleware.
+type Scheduler struct {
+	opts   options
+	node   core.Node
+	store  Store
+	leader Leader
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(node core.Node, store Store, leader Leader, opt ...Option) *Scheduler {
+	opts := defaultOptions()
+	for _, o := range opt {
+		o(&opts)
+	}
+	s := &Scheduler{opts: opts, node: node, store: store, leader: leader}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// NewEtcd returns a Scheduler storing messages under prefix in etcd, the
+// leader lease expires ttl after the leading node died.
+func NewEtcd(node core.Node, client *clientv3.Client, prefix string, ttl time.Duration, opt ...Option) *Scheduler {
+	return New(node,
+		NewEtcdStore(client, prefix),
+		NewEtcdLeader(client, prefix+"/leader", node.Name(), ttl),
+		opt...)
+}
+
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run()
+	}()
+}
+
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	s.leader.Resign(ctx)
+}
+
+// SendAfter stores message to be sent to to after delay and returns the id to
+// cancel it with. to is usually a cluster-named PID.
+func (s *Scheduler) SendAfter(ctx context.Context, to core.PID, message proto.Message, delay time.Duration) (string, error) {
+	return s.SendAt(ctx, to, message, time.Now().Add(delay))
+}
+
+func (s *Scheduler) SendAt(ctx context.Context, to core.PID, message proto.Message, at time.Time) (string, error) {
+	data, err := remote.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	b, err := proto.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	e := &Entry{ID: newEntryID(at), To: to, FireAt: at, Data: b}
+	e.MessageID = e.ID
+	if err := s.store.Save(ctx, e); err != nil {
+		return "", err
+	}
+	return e.ID, nil
+}
+
+// Cancel removes a pending message, it reports false if the message has
+// already fired or does not exist.
+func (s *Scheduler) Cancel(ctx context.Context, id string) (bool, error) {
+	return s.store.Remove(ctx, id)
+}
+
+func newEntryID(at time.Time) string {
+	return fmt.Sprintf("%020d-%s", at.UnixNano(), uuid.New().String())
+}
+
+func (s *Scheduler) run() {
+	for s.ctx.Err() == nil {
+		lost, err := s.leader.Campaign(s.ctx)
+		if err != nil {
+			if s.ctx.Err() == nil {
+				log.Println("scheduler: campaign failed:", err)
+				s.sleep(s.opts.interval)
+			}
+			continue
+		}
+		log.Println("scheduler: became leader on", s.node.Name())
+		s.lead(lost)
+	}
+}
+
+func (s *Scheduler) lead(lost <-chan struct{}) {
+	ticker := time.NewTicker(s.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-lost:
+			log.Println("scheduler: lost leadership on", s.node.Name())
+			return
+		case <-ticker.C:
+			if err := s.fireDue(lost); err != nil {
+				log.Println("scheduler: fire due messages failed:", err)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) fireDue(lost <-chan struct{}) error {
+	entries, err := s.store.Due(s.ctx, time.Now(), s.opts.batch)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		select {
+		case <-lost:
+			return nil
+		default:
+		}
+
+		if err := s.fire(e); err != nil && !s.retry(e, err) {
+			// Kept as is, it is sent again on the next poll.
+			continue
+		}
+		// Not deleted if it has been cancelled while being sent.
+		if _, err := s.store.Complete(s.ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) fire(e *Entry) error {
+	data := &anypb.Any{}
+	if err := proto.Unmarshal(e.Data, data); err != nil {
+		return err
+	}
+	message, err := remote.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, time.Second*5)
+	defer cancel()
+	return s.node.SendMessage(ctx, e.To, core.Message{
+		Data:   message,
+		Header: map[string]string{HeaderMessageID: e.messageID()},
+	})
+}
+
+// retry saves a copy of e to be sent again after RetryDelay, e itself is
+// completed by the caller unless the copy could not be saved.
+func (s *Scheduler) retry(e *Entry, err error) bool {
+	if e.Attempts+1 >= s.opts.maxAttempts {
+		log.Printf("scheduler: drop message %s to %v after %d attempts: %v\n", e.messageID(), e.To, e.Attempts+1, err)
+		return true
+	}
+
+	r := *e
+	r.Attempts++
+	r.MessageID = e.messageID()
+	r.FireAt = time.Now().Add(s.opts.retryDelay)
+	r.ID = newEntryID(r.FireAt)
+	if err := s.store.Save(s.ctx, &r); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("scheduler: reschedule message to %v failed: %v\n", e.To, err)
+		}
+		return false
+	}
+	return true
+}
+
+func (s *Scheduler) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-s.ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/core"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// Entry is a pending scheduled message. Data is the marshaled
+// google.protobuf.Any of the message. MessageID is kept when the entry is
+// rescheduled after a failed delivery, unlike ID.
+type Entry struct {
+	ID        string    `json:"id"`
+	MessageID string    `json:"messageId"`
+	To        core.PID  `json:"to"`
+	FireAt    time.Time `json:"fireAt"`
+	Data      []byte    `json:"data"`
+	Attempts  int       `json:"attempts"`
+	// Rev is the revision of the entry in the store when it was read.
+	Rev int64 `json:"-"`
+}
+
+// messageID returns the id of the message of e, entries saved before
+// MessageID existed use their own id.
+func (e *Entry) messageID() string {
+	if e.MessageID == "" {
+		return e.ID
+	}
+	return e.MessageID
+}
+
+// Store persists pending entries.
+type Store interface {
+	Save(ctx context.Context, e *Entry) error
+	// Due returns the entries whose FireAt is not after t, oldest first.
+	Due(ctx context.Context, t time.Time, limit int) ([]*Entry, error)
+	// Remove deletes the entry, it reports true to exactly one caller.
+	Remove(ctx context.Context, id string) (bool, error)
+	// Complete deletes e unless it has been saved again since Due returned
+	// it, it reports whether e has been deleted.
+	Complete(ctx context.Context, e *Entry) (bool, error)
+}
+
+// Leader elects the node firing the entries of a Store.
+type Leader interface {
+	// Campaign blocks until this node is the leader, the returned channel is
+	// closed once leadership is lost.
+	Campaign(ctx context.Context) (<-chan struct{}, error)
+	Resign(ctx context.Context) error
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+	rev     int64
+}
+
+// NewMemoryStore returns a Store for a single node, its entries do not
+// survive a restart.
+func NewMemoryStore() Store {
+	return &memoryStore{entries: make(map[string]*Entry)}
+}
+
+func (s *memoryStore) Save(ctx context.Context, e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rev++
+	c := *e
+	c.Rev = s.rev
+	s.entries[e.ID] = &c
+	return nil
+}
+
+func (s *memoryStore) Due(ctx context.Context, t time.Time, limit int) ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []*Entry
+	for _, e := range s.entries {
+		if !e.FireAt.After(t) {
+			c := *e
+			results = append(results, &c)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].FireAt.Before(results[j].FireAt)
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *memoryStore) Remove(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[id]; !ok {
+		return false, nil
+	}
+	delete(s.entries, id)
+	return true, nil
+}
+
+func (s *memoryStore) Complete(ctx context.Context, e *Entry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.entries[e.ID]; !ok || c.Rev != e.Rev {
+		return false, nil
+	}
+	delete(s.entries, e.ID)
+	return true, nil
+}
+
+type localLeader struct{}
+
+// LocalLeader always wins the election, for a scheduler running on a single
+// node.
+func LocalLeader() Leader {
+	return localLeader{}
+}
+
+func (localLeader) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	return make(chan struct{}), nil
+}
+
+func (localLeader) Resign(ctx context.Context) error {
+	return nil
+}
+
+type etcdStore struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// NewEtcdStore keeps entries under prefix. Keys sort by fire time, so due
+// entries are found with a range read.
+func NewEtcdStore(client *clientv3.Client, prefix string) Store {
+	return &etcdStore{client: client, prefix: strings.TrimSuffix(prefix, "/") + "/entries/"}
+}
+
+func (s *etcdStore) Save(ctx context.Context, e *Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Put(ctx, s.prefix+e.ID, string(b))
+	return err
+}
+
+func (s *etcdStore) Due(ctx context.Context, t time.Time, limit int) ([]*Entry, error) {
+	// IDs start with the zero padded fire time, see newEntryID.
+	end := s.prefix + fmt.Sprintf("%020d", t.UnixNano()+1)
+	opts := []clientv3.OpOption{clientv3.WithRange(end), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend)}
+	if limit > 0 {
+		opts = append(opts, clientv3.WithLimit(int64(limit)))
+	}
+	resp, err := s.client.Get(ctx, s.prefix, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Entry, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		e := &Entry{}
+		if err := json.Unmarshal(kv.Value, e); err != nil {
+			continue
+		}
+		e.Rev = kv.ModRevision
+		results = append(results, e)
+	}
+	return results, nil
+}
+
+func (s *etcdStore) Remove(ctx context.Context, id string) (bool, error) {
+	key := s.prefix + id
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+func (s *etcdStore) Complete(ctx context.Context, e *Entry) (bool, error) {
+	key := s.prefix + e.ID
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", e.Rev)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+type etcdLeader struct {
+	client *clientv3.Client
+	key    string
+	value  string
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	session  *concurrency.Session
+	election *concurrency.Election
+}
+
+// NewEtcdLeader campaigns for key with a session lease of ttl, the leader
+// changes at the latest ttl after the leading node has died. The ttl is
+// rounded up to whole seconds, the granularity of etcd leases.
+func NewEtcdLeader(client *clientv3.Client, key string, value string, ttl time.Duration) Leader {
+	return &etcdLeader{client: client, key: key, value: value, ttl: ttl}
+}
+
+func (l *etcdLeader) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	// The session of the previous term is closed, its keepalive would run
+	// until the client is closed otherwise.
+	l.mu.Lock()
+	prev := l.session
+	l.session, l.election = nil, nil
+	l.mu.Unlock()
+	if prev != nil {
+		prev.Close()
+	}
+
+	session, err := concurrency.NewSession(l.client, concurrency.WithTTL(int(math.Ceil(l.ttl.Seconds()))), concurrency.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	election := concurrency.NewElection(session, l.key)
+	if err := election.Campaign(ctx, l.value); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.session, l.election = session, election
+	l.mu.Unlock()
+	return session.Done(), nil
+}
+
+func (l *etcdLeader) Resign(ctx context.Context) error {
+	l.mu.Lock()
+	session, election := l.session, l.election
+	l.session, l.election = nil, nil
+	l.mu.Unlock()
+
+	if session == nil {
+		return nil
+	}
+	defer session.Close()
+	return election.Resign(ctx)
+}
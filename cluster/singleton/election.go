@@ -0,0 +1,184 @@
+package singleton
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// Election elects the node running the singleton.
+type Election interface {
+	// Campaign blocks until node is elected, the returned channel is closed
+	// once the leadership is lost.
+	Campaign(ctx context.Context, node string) (<-chan struct{}, error)
+	// Resign gives up the leadership of node, if it holds it.
+	Resign(ctx context.Context, node string) error
+	// Observe sends the leader every time it changes, an empty name if there
+	// is none, the channel is closed once ctx is done.
+	Observe(ctx context.Context) <-chan string
+}
+
+type memoryElection struct {
+	mu        sync.Mutex
+	leader    string
+	lost      chan struct{}
+	free      chan struct{}
+	observers map[chan string]struct{}
+}
+
+// NewMemoryElection returns an Election among the nodes of this process.
+func NewMemoryElection() Election {
+	return &memoryElection{free: make(chan struct{}), observers: make(map[chan string]struct{})}
+}
+
+func (e *memoryElection) Campaign(ctx context.Context, node string) (<-chan struct{}, error) {
+	for {
+		e.mu.Lock()
+		if e.leader == "" {
+			e.leader = node
+			e.lost = make(chan struct{})
+			lost := e.lost
+			e.notify()
+			e.mu.Unlock()
+			return lost, nil
+		}
+		free := e.free
+		e.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-free:
+		}
+	}
+}
+
+func (e *memoryElection) Resign(ctx context.Context, node string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leader != node {
+		return nil
+	}
+	e.leader = ""
+	close(e.lost)
+	close(e.free)
+	e.free = make(chan struct{})
+	e.notify()
+	return nil
+}
+
+func (e *memoryElection) Observe(ctx context.Context) <-chan string {
+	ch := make(chan string, 1)
+	e.mu.Lock()
+	e.observers[ch] = struct{}{}
+	ch <- e.leader
+	e.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		e.mu.Lock()
+		delete(e.observers, ch)
+		close(ch)
+		e.mu.Unlock()
+	}()
+	return ch
+}
+
+// notify sends the leader to the observers, replacing the leader they have
+// not received yet. e.mu must be held.
+func (e *memoryElection) notify() {
+	for ch := range e.observers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- e.leader
+	}
+}
+
+type etcdElection struct {
+	client *clientv3.Client
+	key    string
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	session  *concurrency.Session
+	election *concurrency.Election
+}
+
+// NewEtcdElection campaigns for key with a session lease of ttl, another node
+// is elected at the latest ttl after the leader has died.
+func NewEtcdElection(client *clientv3.Client, key string, ttl time.Duration) Election {
+	return &etcdElection{client: client, key: key, ttl: ttl}
+}
+
+func (e *etcdElection) Campaign(ctx context.Context, node string) (<-chan struct{}, error) {
+	session, err := concurrency.NewSession(e.client, concurrency.WithTTL(int(e.ttl.Seconds())), concurrency.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	election := concurrency.NewElection(session, e.key)
+	if err := election.Campaign(ctx, node); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.session, e.election = session, election
+	e.mu.Unlock()
+	return session.Done(), nil
+}
+
+func (e *etcdElection) Resign(ctx context.Context, node string) error {
+	e.mu.Lock()
+	session, election := e.session, e.election
+	e.session, e.election = nil, nil
+	e.mu.Unlock()
+
+	if session == nil {
+		return nil
+	}
+	defer session.Close()
+	return election.Resign(ctx)
+}
+
+// Observe reads the leader, the candidate with the oldest key, every time the
+// keys of the election change.
+func (e *etcdElection) Observe(ctx context.Context) <-chan string {
+	ch := make(chan string)
+	prefix := e.key + "/"
+	go func() {
+		defer close(ch)
+
+		for ctx.Err() == nil {
+			resp, err := e.client.Get(ctx, prefix, clientv3.WithFirstCreate()...)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("singleton: get leader of %s failed: %v\n", e.key, err)
+					time.Sleep(time.Second)
+				}
+				continue
+			}
+			var leader string
+			if len(resp.Kvs) > 0 {
+				leader = string(resp.Kvs[0].Value)
+			}
+			select {
+			case ch <- leader:
+			case <-ctx.Done():
+				return
+			}
+
+			wctx, cancel := context.WithCancel(ctx)
+			wch := e.client.Watch(wctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+			<-wch
+			cancel()
+		}
+	}()
+	return ch
+}
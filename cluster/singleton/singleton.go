@@ -0,0 +1,331 @@
+// Package singleton runs a process on exactly one node of the cluster. Every
+// node runs a Manager campaigning in an Election, the elected node spawns the
+// singleton and the others take over once it is gone: right away when its
+// Manager is stopped, or once its election lease has expired when it died.
+//
+// The singleton is reached through the proxy of the Manager of any node. The
+// proxy forwards the messages to the node currently running the singleton and
+// buffers them while there is none:
+//
+//	m := singleton.NewEtcd(node, client, "singletons", "billing", time.Second*15, producer)
+//	m.Start()
+//	node.SendMessage(ctx, m.PID(), core.Message{Data: msg})
+//
+// A singleton may briefly run on two nodes when the leader is cut from etcd
+// but still running, until its lease has expired.
+package singleton
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/core"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	singletonIDPrefix = "singleton/"
+	proxyIDPrefix     = "singleton-proxy/"
+)
+
+type options struct {
+	bufferSize int
+	retryDelay time.Duration
+	proxyOnly  bool
+}
+
+func defaultOptions() options {
+	return options{
+		bufferSize: 1000,
+		retryDelay: time.Second,
+	}
+}
+
+type Option func(*options)
+
+// BufferSize sets how many messages the proxy keeps while the singleton is
+// unreachable, the oldest message is dropped once the buffer is full.
+func BufferSize(n int) Option {
+	return func(o *options) {
+		o.bufferSize = n
+	}
+}
+
+// RetryDelay sets how long the proxy waits before sending again a message it
+// failed to send, and how long the Manager waits before spawning again a
+// singleton that has stopped.
+func RetryDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.retryDelay = d
+	}
+}
+
+// ProxyOnly runs the proxy on this node without ever running the singleton,
+// for the nodes not meant to host it.
+func ProxyOnly() Option {
+	return func(o *options) {
+		o.proxyOnly = true
+	}
+}
+
+// ID returns the ID of the PID of the singleton name on its node.
+func ID(name string) string {
+	return singletonIDPrefix + name
+}
+
+type Manager struct {
+	opts     options
+	node     core.Node
+	name     string
+	producer func() core.ProcessBehavior
+	election Election
+
+	mu      sync.Mutex
+	leader  string
+	changed chan struct{}
+
+	proxy  core.Process
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns the Manager of the singleton name on node, producer returns the
+// behavior of the singleton every time it is spawned.
+func New(node core.Node, name string, producer func() core.ProcessBehavior, election Election, opt ...Option) *Manager {
+	opts := defaultOptions()
+	for _, o := range opt {
+		o(&opts)
+	}
+	m := &Manager{
+		opts:     opts,
+		node:     node,
+		name:     name,
+		producer: producer,
+		election: election,
+		changed:  make(chan struct{}),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m
+}
+
+// NewEtcd returns a Manager electing the node of the singleton under prefix in
+// etcd, another node takes over at the latest ttl after it has died.
+func NewEtcd(node core.Node, client *clientv3.Client, prefix string, name string, ttl time.Duration, producer func() core.ProcessBehavior, opt ...Option) *Manager {
+	return New(node, name, producer, NewEtcdElection(client, prefix+"/"+name, ttl), opt...)
+}
+
+// PID returns the PID of the proxy of the singleton on this node.
+func (m *Manager) PID() core.PID {
+	return core.PID{Node: m.node.Name(), ID: proxyIDPrefix + m.name}
+}
+
+// Leader returns the node running the singleton, if any is known.
+func (m *Manager) Leader() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.leader, m.leader != ""
+}
+
+func (m *Manager) Start() error {
+	proxy, err := m.node.Spawn(&proxy{m: m}, &core.SpawnOptions{Name: proxyIDPrefix + m.name})
+	if err != nil {
+		return err
+	}
+	m.proxy = proxy
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.observe()
+	}()
+	if !m.opts.proxyOnly {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.run()
+		}()
+	}
+	return nil
+}
+
+// Stop stops the singleton if it runs on this node and hands it over to
+// another node, then stops the proxy.
+func (m *Manager) Stop() {
+	m.cancel()
+	m.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := m.election.Resign(ctx, m.node.Name()); err != nil {
+		log.Printf("singleton: resign %s failed: %v\n", m.name, err)
+	}
+
+	m.proxy.Stop()
+	m.proxy.Wait()
+}
+
+func (m *Manager) observe() {
+	for leader := range m.election.Observe(m.ctx) {
+		m.mu.Lock()
+		if leader != m.leader {
+			log.Printf("singleton: %s is on %q\n", m.name, leader)
+			m.leader = leader
+			close(m.changed)
+			m.changed = make(chan struct{})
+		}
+		m.mu.Unlock()
+
+		if m.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// target returns the PID of the singleton, and a channel closed when its node
+// changes.
+func (m *Manager) target() (core.PID, bool, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return core.PID{Node: m.leader, ID: ID(m.name)}, m.leader != "", m.changed
+}
+
+func (m *Manager) run() {
+	for m.ctx.Err() == nil {
+		lost, err := m.election.Campaign(m.ctx, m.node.Name())
+		if err != nil {
+			if m.ctx.Err() == nil {
+				log.Printf("singleton: campaign for %s failed: %v\n", m.name, err)
+				m.sleep(m.opts.retryDelay)
+			}
+			continue
+		}
+		log.Printf("singleton: %s elected on %s\n", m.name, m.node.Name())
+		m.lead(lost)
+	}
+}
+
+// lead runs the singleton until the leadership is lost or the Manager is
+// stopped, spawning it again if it stops on its own.
+func (m *Manager) lead(lost <-chan struct{}) {
+	for {
+		process, err := m.node.Spawn(m.producer(), &core.SpawnOptions{Name: ID(m.name)})
+		if err != nil {
+			log.Printf("singleton: spawn %s failed: %v\n", m.name, err)
+			if !m.wait(lost, m.opts.retryDelay) {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-m.ctx.Done():
+			m.stopProcess(process)
+			return
+		case <-lost:
+			log.Printf("singleton: %s lost leadership on %s\n", m.name, m.node.Name())
+			m.stopProcess(process)
+			return
+		case <-process.Context().Done():
+			log.Printf("singleton: %s stopped, spawning it again\n", m.name)
+			if !m.wait(lost, m.opts.retryDelay) {
+				return
+			}
+		}
+	}
+}
+
+func (m *Manager) stopProcess(process core.Process) {
+	process.Stop()
+	process.Wait()
+}
+
+// wait waits for d, it reports false if the leadership is lost or the Manager
+// is stopped.
+func (m *Manager) wait(lost <-chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-m.ctx.Done():
+		return false
+	case <-lost:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (m *Manager) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-m.ctx.Done():
+	case <-t.C:
+	}
+}
+
+// proxy forwards the messages to the singleton in the order they were
+// received, buffering them while it is unreachable.
+type proxy struct {
+	m      *Manager
+	buffer []core.Message
+	failed bool
+}
+
+func (p *proxy) ProcessLoop(process core.Process) error {
+	channels := process.ProcessChannels()
+	retry := time.NewTicker(p.m.opts.retryDelay)
+	defer retry.Stop()
+
+	for {
+		_, _, changed := p.m.target()
+		select {
+		case <-process.Context().Done():
+			return nil
+		case <-channels.Exit:
+			if len(p.buffer) > 0 {
+				log.Printf("singleton: proxy of %s stopped with %d messages\n", p.m.name, len(p.buffer))
+			}
+			return nil
+		case message := <-channels.Mailbox:
+			if len(p.buffer) == p.m.opts.bufferSize {
+				log.Printf("singleton: proxy of %s full, dropping a message\n", p.m.name)
+				p.buffer = p.buffer[1:]
+			}
+			p.buffer = append(p.buffer, message)
+		case <-changed:
+		case <-retry.C:
+		}
+
+		err := p.flush(process.Context())
+		if err != nil && !p.failed {
+			log.Printf("singleton: send to %s failed, buffering: %v\n", p.m.name, err)
+		}
+		p.failed = err != nil
+	}
+}
+
+// flush sends the buffered messages until one fails, the failed message is
+// sent again on the next flush.
+func (p *proxy) flush(ctx context.Context) error {
+	for len(p.buffer) > 0 {
+		to, ok, _ := p.m.target()
+		if !ok {
+			return nil
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+		err := p.m.node.SendMessage(sendCtx, to, p.buffer[0])
+		cancel()
+		if err != nil {
+			return err
+		}
+		p.buffer[0] = core.Message{}
+		p.buffer = p.buffer[1:]
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// ProcessStarted is published when a process of the node has been spawned.
+type ProcessStarted struct {
+	PID    PID
+	Parent PID
+}
+
+// ProcessStopped is published when a process of the node has exited, Err is
+// the error returned by its ProcessLoop.
+type ProcessStopped struct {
+	PID PID
+	Err error
+}
+
+// DeadLetter is published when a message is sent to a process of the node
+// that does not exist.
+type DeadLetter struct {
+	To      PID
+	Message Message
+}
+
+// EventStream publishes events to the local processes that subscribed to
+// them. Subscriptions are removed when their subscriber exits.
+//
+// Every subscription has a queue of EventQueueSize events, delivered to the
+// mailbox of the subscriber by a goroutine of its own, so that Publish never
+// waits for a subscriber: it runs within spawns and sends. The events
+// overflowing the queue of a slow subscriber are dropped and counted.
+type EventStream struct {
+	// dropped is first to be 64-bit aligned for atomic access.
+	dropped int64
+	node    *node
+
+	mu     sync.RWMutex
+	nextID int64
+	subs   map[int64]*Subscription
+}
+
+// EventQueueSize is how many events may wait to be delivered to a subscriber.
+const EventQueueSize = 1024
+
+type Subscription struct {
+	dropped   int64
+	id        int64
+	pid       PID
+	predicate func(event interface{}) bool
+	stream    *EventStream
+	queue     chan interface{}
+	done      chan struct{}
+	once      sync.Once
+}
+
+func newEventStream(node *node) *EventStream {
+	return &EventStream{node: node, subs: make(map[int64]*Subscription)}
+}
+
+// Subscribe delivers to pid every event for which predicate returns true,
+// predicate is called by the goroutine publishing the event.
+func (s *EventStream) Subscribe(pid PID, predicate func(event interface{}) bool) (*Subscription, error) {
+	p, err := s.node.registry.Get(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The process may have exited since it was looked up. Its context is
+	// canceled before its subscriptions are removed, so while it is not the
+	// subscription added here is removed with the others.
+	if p.ctx.Err() != nil {
+		return nil, ErrProcessNotFound
+	}
+
+	s.nextID++
+	sub := &Subscription{
+		id:        s.nextID,
+		pid:       pid,
+		predicate: predicate,
+		stream:    s,
+		queue:     make(chan interface{}, EventQueueSize),
+		done:      make(chan struct{}),
+	}
+	s.subs[sub.id] = sub
+	go sub.deliver(p)
+	return sub, nil
+}
+
+func (s *Subscription) deliver(p *process) {
+	for {
+		select {
+		case event := <-s.queue:
+			select {
+			case p.mailbox <- Message{Data: event}:
+			case <-p.ctx.Done():
+				return
+			case <-s.done:
+				return
+			}
+		case <-p.ctx.Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Dropped returns how many events have been dropped for this subscription
+// because its queue was full.
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+func (s *Subscription) Unsubscribe() {
+	s.stream.mu.Lock()
+	defer s.stream.mu.Unlock()
+
+	delete(s.stream.subs, s.id)
+	s.stop()
+}
+
+func (s *Subscription) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *EventStream) unsubscribeAll(pid PID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, sub := range s.subs {
+		if sub.pid == pid {
+			delete(s.subs, id)
+			sub.stop()
+		}
+	}
+}
+
+// Dropped returns how many events have been dropped for all the
+// subscriptions because their queue was full.
+func (s *EventStream) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Publish queues event for the matching subscribers without waiting, the
+// event is dropped for the subscribers whose queue is full.
+func (s *EventStream) Publish(event interface{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, sub := range s.subs {
+		if sub.predicate != nil && !sub.predicate(event) {
+			continue
+		}
+		select {
+		case sub.queue <- event:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+			// Logged once per queue size, a stuck subscriber would flood the
+			// log otherwise.
+			if n := atomic.AddInt64(&sub.dropped, 1); n%EventQueueSize == 1 {
+				log.Printf("core: event stream drop %T for %v: queue full, %d dropped\n", event, sub.pid, n)
+			}
+		}
+	}
+}
@@ -1,16 +1,43 @@
 package core
 
+import "time"
+
 const (
 	MessageFlagResponse = 1
+	MessageFlagRequest  = 2
+	// MessageFlagStreamRequest marks a request opening a stream.
+	MessageFlagStreamRequest = 4
+	// MessageFlagStream marks a frame of an open stream, frames between the
+	// same pair of processes are delivered in order.
+	MessageFlagStream = 8
+	// MessageFlagStreamEnd marks the last frame sent in one direction of a
+	// stream.
+	MessageFlagStreamEnd = 16
 )
 
+// HeaderIdempotencyKey carries a key shared by the attempts to send a same
+// message, receivers drop the attempts of a key they have already handled.
+const HeaderIdempotencyKey = "idempotency-key"
+
 type Message struct {
 	From      PID
 	RequestID int64
 	Flag      int32
 	Data      interface{}
+
+	// SentAt is the time the request was issued by the caller, zero if unknown.
+	SentAt time.Time
+	// Deadline is the time after which the caller is no longer waiting for a
+	// response, zero if the message has no deadline.
+	Deadline time.Time
+	// Header carries optional metadata such as an idempotency key.
+	Header map[string]string
 }
 
 func (m *Message) TestFlag(flag int32) bool {
 	return m.Flag&flag != 0
 }
+
+func (m *Message) Expired() bool {
+	return !m.Deadline.IsZero() && time.Now().After(m.Deadline)
+}
@@ -2,16 +2,41 @@ package core
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 )
 
+// Activator spawns processes on demand. It is called when a message is sent
+// to a local PID that has no process, before the message is a dead letter.
+type Activator interface {
+	// Activate spawns the process of pid, or returns ErrProcessNotFound if pid
+	// is not activated on demand. It may return a *RedirectError to have the
+	// message sent to the process elsewhere.
+	Activate(pid PID) (Process, error)
+}
+
+// RedirectError is returned by an Activator when the process of a PID lives
+// on another node.
+type RedirectError struct {
+	To PID
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("process %s lives on %s", e.To.ID, e.To.Node)
+}
+
 type Node interface {
 	Name() string
 	Spawn(behavior ProcessBehavior, opts *SpawnOptions) (Process, error)
+	Lookup(pid PID) (Process, error)
 	SendMessage(ctx context.Context, to PID, message Message) error
 	Stop()
 	Wait()
 	Join(c Cluster)
 	Cluster() Cluster
+	EventStream() *EventStream
+	SetActivator(a Activator)
 }
 
 type node struct {
@@ -23,6 +48,19 @@ type node struct {
 	registry *ProcessRegistry
 
 	cluster Cluster
+
+	events *EventStream
+
+	activator  Activator
+	activateMu sync.Mutex
+	activating map[string]*activation
+}
+
+// activation is an Activate call in progress, concurrent messages to the same
+// PID wait for it instead of activating the process again.
+type activation struct {
+	done chan struct{}
+	err  error
 }
 
 func NewNode(name string) Node {
@@ -31,9 +69,11 @@ func NewNode(name string) Node {
 		ctx:    ctx,
 		cancel: cancel,
 
-		name:     name,
-		registry: newProcessRegistry(),
+		name:       name,
+		registry:   newProcessRegistry(),
+		activating: make(map[string]*activation),
 	}
+	node.events = newEventStream(node)
 	return node
 }
 
@@ -88,18 +128,24 @@ func (n *node) spawn(parent *process, behavior ProcessBehavior, opts *SpawnOptio
 		return nil, err
 	}
 
+	started := &ProcessStarted{PID: p.pid}
 	if parent != nil {
 		parent.addChild(p)
+		started.Parent = parent.pid
 	}
 	cleanProcess := func(err error) {
 		if parent != nil {
 			parent.deleteChild(p)
 		}
 		n.registry.Delete(p)
-
+		// Canceling before unsubscribing lets Subscribe tell, under the lock of
+		// the stream, whether the subscriptions of p have been removed already.
 		p.cancel()
+		n.events.unsubscribeAll(p.pid)
+		n.events.Publish(&ProcessStopped{PID: p.pid, Err: err})
 	}
 
+	n.events.Publish(started)
 	go func(p Process) {
 		err := behavior.ProcessLoop(p)
 		cleanProcess(err)
@@ -115,13 +161,33 @@ func (n *node) Spawn(behavior ProcessBehavior, opts *SpawnOptions) (Process, err
 	return n.spawn(nil, behavior, opts)
 }
 
+// Lookup returns the local process of pid.
+func (n *node) Lookup(pid PID) (Process, error) {
+	if pid.Node != n.name {
+		return nil, ErrProcessNotFound
+	}
+	p, err := n.registry.Get(pid)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 func (n *node) SendMessage(ctx context.Context, to PID, message Message) error {
 	if to.Node != n.name {
 		return n.cluster.SendMessage(ctx, to, message)
 	}
 
 	process, err := n.registry.Get(to)
+	if err != nil && n.activator != nil {
+		process, err = n.activate(to)
+		var redirect *RedirectError
+		if errors.As(err, &redirect) {
+			return n.SendMessage(ctx, redirect.To, message)
+		}
+	}
 	if err != nil {
+		n.events.Publish(&DeadLetter{To: to, Message: message})
 		return err
 	}
 
@@ -133,6 +199,38 @@ func (n *node) SendMessage(ctx context.Context, to PID, message Message) error {
 	return nil
 }
 
+func (n *node) activate(pid PID) (*process, error) {
+	n.activateMu.Lock()
+	if a, ok := n.activating[pid.ID]; ok {
+		n.activateMu.Unlock()
+		<-a.done
+		if a.err != nil {
+			return nil, a.err
+		}
+		return n.registry.Get(pid)
+	}
+	a := &activation{done: make(chan struct{})}
+	n.activating[pid.ID] = a
+	n.activateMu.Unlock()
+
+	defer func() {
+		n.activateMu.Lock()
+		delete(n.activating, pid.ID)
+		n.activateMu.Unlock()
+		close(a.done)
+	}()
+
+	// The process may have been activated since the registry was read.
+	if p, err := n.registry.Get(pid); err == nil {
+		return p, nil
+	}
+	if _, err := n.activator.Activate(pid); err != nil && !errors.Is(err, ErrDupProcessName) {
+		a.err = err
+		return nil, err
+	}
+	return n.registry.Get(pid)
+}
+
 func (n *node) Stop() {
 	n.cancel()
 }
@@ -148,3 +246,13 @@ func (n *node) Join(c Cluster) {
 func (n *node) Cluster() Cluster {
 	return n.cluster
 }
+
+func (n *node) EventStream() *EventStream {
+	return n.events
+}
+
+// SetActivator sets the Activator of the node, it must be set before messages
+// are sent to the processes it activates.
+func (n *node) SetActivator(a Activator) {
+	n.activator = a
+}
@@ -66,6 +66,10 @@ func (p *process) SendCtx(ctx context.Context, to PID, message interface{}) erro
 	})
 }
 
+func (p *process) Node() Node {
+	return p.node
+}
+
 func (p *process) ProcessChannels() ProcessChannels {
 	return ProcessChannels{
 		Mailbox: p.mailbox,
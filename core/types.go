@@ -23,6 +23,7 @@ type Process interface {
 	Spawn(behavior ProcessBehavior, opts *SpawnOptions) (Process, error)
 	Behavior() ProcessBehavior
 	ProcessChannels() ProcessChannels
+	Node() Node
 	Stop() error
 	Wait()
 	Kill()
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"runtime"
 	"sync"
 	"syscall"
 	"time"
@@ -36,12 +37,17 @@ func main() {
 		panic(err)
 	}
 
-	p2, err := node.SpawnActor(actor.ActorFunc(func(c actor.Context) {
-		switch c.Message().(type) {
-		case *ping:
-			c.Send(c.From(), _pong)
-		}
+	p2, err := node.SpawnActor(actor.NewPoolRouter(actor.RoundRobinStrategy(), runtime.NumCPU(), func() actor.Actor {
+		return actor.ActorFunc(func(c actor.Context) {
+			switch c.Message().(type) {
+			case *ping:
+				c.Send(c.From(), _pong)
+			}
+		})
 	}))
+	if err != nil {
+		panic(err)
+	}
 
 	wg.Add(N)
 	go func() {
@@ -18,10 +18,6 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
-var (
-	clients = make(map[*Client]struct{})
-)
-
 type Client struct {
 	Username string
 	conn     *websocket.Conn
@@ -54,6 +50,11 @@ func serveWs(serverProcess actor.Process, w http.ResponseWriter, r *http.Request
 		panic(err)
 	}
 
+	// The subscription is removed when the client process stops.
+	if _, err := clientProcess.Subscribe(actor.EventTypes((*chat.SayReply)(nil))); err != nil {
+		panic(err)
+	}
+
 	client := &Client{conn: conn, Username: username, Process: clientProcess}
 	clientProcess.Send(serverProcess.Self(), &clientConnected{client: client})
 
@@ -83,12 +84,6 @@ func serveWs(serverProcess actor.Process, w http.ResponseWriter, r *http.Request
 	}()
 }
 
-func notifyAll(context actor.Context, message interface{}) {
-	for client := range clients {
-		context.Send(client.Self(), message)
-	}
-}
-
 type clientConnected struct {
 	client *Client
 }
@@ -104,14 +99,12 @@ func main() {
 		switch msg := c.Message().(type) {
 		case *clientConnected:
 			log.Println("client connected", msg.client.Username)
-			clients[msg.client] = struct{}{}
-			notifyAll(c, &chat.SayReply{Username: "server", Message: fmt.Sprintf("Welcome, %s!", msg.client.Username)})
+			c.Publish(&chat.SayReply{Username: "server", Message: fmt.Sprintf("Welcome, %s!", msg.client.Username)})
 		case *clientDisconnect:
 			log.Println("client disconnected", msg.client.Username)
-			delete(clients, msg.client)
-			notifyAll(c, &chat.SayReply{Username: "server", Message: fmt.Sprintf("%s Leaved!", msg.client.Username)})
+			c.Publish(&chat.SayReply{Username: "server", Message: fmt.Sprintf("%s Leaved!", msg.client.Username)})
 		case *chat.SayRequest:
-			notifyAll(c, &chat.SayReply{
+			c.Publish(&chat.SayReply{
 				Username: msg.Username,
 				Message:  msg.Message,
 			})
@@ -10,17 +10,13 @@ type hello struct {
 	Who string
 }
 
-type helloActor struct {
-	cancel actor.CancelFunc
-}
+type helloActor struct{}
 
 func (state *helloActor) Receive(context actor.Context) {
 	switch msg := context.Message().(type) {
 	case *actor.Started:
-		scheduler := actor.NewTimerScheduler(context)
-		state.cancel = scheduler.SendRepeatedly(context.Self(), &hello{Who: "Roger"}, time.Second*3)
+		context.Timers().StartPeriodicTimer("hello", &hello{Who: "Roger"}, time.Second*3)
 	case *actor.Stopping:
-		state.cancel()
 	case *actor.Stopped:
 	case *hello:
 		fmt.Printf("Hello %v\n", msg.Who)
@@ -18,7 +18,11 @@ const (
 
 func main() {
 	node := actor.NewNode("node1")
-	c := cluster.NewCluster(node, "localhost:9700")
+	c, err := actor.NewCluster(node, cluster.NewMemoryBackend(), cluster.Address("localhost"), cluster.Port(9700))
+	if err != nil {
+		panic(err)
+	}
+	defer c.Stop()
 	c.StaticRoute("node2", "localhost:9701", nil)
 
 	wg := &sync.WaitGroup{}
@@ -11,7 +11,11 @@ import (
 
 func main() {
 	node := actor.NewNode("node2")
-	c := cluster.NewCluster(node, "localhost:9701")
+	c, err := actor.NewCluster(node, cluster.NewMemoryBackend(), cluster.Address("localhost"), cluster.Port(9701))
+	if err != nil {
+		panic(err)
+	}
+	defer c.Stop()
 	c.StaticRoute("node1", "localhost:9700", nil)
 
 	pong := &messages.Pong{}
@@ -12,7 +12,11 @@ import (
 
 func main() {
 	node := actor.NewNode("node1")
-	c := cluster.NewCluster(node, "localhost:9700")
+	c, err := actor.NewCluster(node, cluster.NewMemoryBackend(), cluster.Address("localhost"), cluster.Port(9700))
+	if err != nil {
+		panic(err)
+	}
+	defer c.Stop()
 	c.StaticRoute("node2", "localhost:9701", nil)
 
 	p, err := node.SpawnActor(actor.ActorFunc(func(c actor.Context) {
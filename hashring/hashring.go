@@ -0,0 +1,62 @@
+// Package hashring implements a consistent hash ring with virtual nodes.
+package hashring
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+const DefaultReplicas = 100
+
+// Ring maps keys to members, adding or removing a member only moves the keys
+// of that member. A Ring is immutable and safe for concurrent use.
+type Ring struct {
+	hashes  []uint32
+	members map[uint32]string
+}
+
+func New(replicas int, members ...string) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	r := &Ring{members: make(map[uint32]string, len(members)*replicas)}
+	for _, m := range members {
+		for i := 0; i < replicas; i++ {
+			h := hash(m + "#" + strconv.Itoa(i))
+			if _, ok := r.members[h]; ok {
+				continue
+			}
+			r.members[h] = m
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+func (r *Ring) Get(key string) (string, bool) {
+	if len(r.hashes) == 0 {
+		return "", false
+	}
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.members[r.hashes[i]], true
+}
+
+// hash mixes the bits of fnv, which alone spreads similar keys such as
+// sequential ids poorly around the ring.
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
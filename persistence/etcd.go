@@ -0,0 +1,262 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+type etcdJournal struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// EtcdMaxBatchSize is how many events an etcd journal writes at once. A batch
+// is a single transaction of one operation per event plus one, and etcd
+// rejects transactions of more than --max-txn-ops operations, 128 by default.
+const EtcdMaxBatchSize = 127
+
+// NewEtcdJournal returns a Journal keeping events under prefix in etcd. The
+// keys of the events of a persistence id sort by sequence number, and the
+// highest sequence number is kept in its own key written in the same
+// transaction, which detects concurrent writers. It writes at most
+// EtcdMaxBatchSize events at once.
+func NewEtcdJournal(client *clientv3.Client, prefix string) Journal {
+	return &etcdJournal{client: client, prefix: strings.TrimSuffix(prefix, "/") + "/journal/"}
+}
+
+func (j *etcdJournal) eventsPrefix(persistenceID string) string {
+	return j.prefix + url.PathEscape(persistenceID) + "/events/"
+}
+
+func (j *etcdJournal) eventKey(persistenceID string, seqNr uint64) string {
+	return j.eventsPrefix(persistenceID) + fmt.Sprintf("%020d", seqNr)
+}
+
+func (j *etcdJournal) highestKey(persistenceID string) string {
+	return j.prefix + url.PathEscape(persistenceID) + "/highest"
+}
+
+func (j *etcdJournal) WriteEvents(ctx context.Context, events []*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if len(events) > EtcdMaxBatchSize {
+		return fmt.Errorf("%w: %d events, etcd takes at most %d", ErrBatchTooLarge, len(events), EtcdMaxBatchSize)
+	}
+	id := events[0].PersistenceID
+
+	ops := make([]clientv3.Op, 0, len(events)+1)
+	for _, e := range events {
+		data, err := marshalMessage(e.Message)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(&fileEvent{SeqNr: e.SeqNr, Tags: e.Tags, Timestamp: e.Timestamp, Data: data})
+		if err != nil {
+			return err
+		}
+		ops = append(ops, clientv3.OpPut(j.eventKey(id, e.SeqNr), string(b)))
+	}
+	last := events[len(events)-1].SeqNr
+	ops = append(ops, clientv3.OpPut(j.highestKey(id), fmt.Sprint(last)))
+
+	var cmp clientv3.Cmp
+	if prev := events[0].SeqNr - 1; prev == 0 {
+		cmp = clientv3.Compare(clientv3.CreateRevision(j.highestKey(id)), "=", 0)
+	} else {
+		cmp = clientv3.Compare(clientv3.Value(j.highestKey(id)), "=", fmt.Sprint(prev))
+	}
+	resp, err := j.client.Txn(ctx).If(cmp).Then(ops...).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrSeqNrConflict
+	}
+	return nil
+}
+
+func (j *etcdJournal) ReadEvents(ctx context.Context, persistenceID string, from uint64, to uint64, fn func(e *Event) error) error {
+	const page = 100
+
+	key := j.eventKey(persistenceID, from)
+	end := clientv3.GetPrefixRangeEnd(j.eventsPrefix(persistenceID))
+	if to < ^uint64(0) {
+		end = j.eventKey(persistenceID, to+1)
+	}
+	for {
+		resp, err := j.client.Get(ctx, key,
+			clientv3.WithRange(end),
+			clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+			clientv3.WithLimit(page))
+		if err != nil {
+			return err
+		}
+
+		for _, kv := range resp.Kvs {
+			fe := &fileEvent{}
+			if err := json.Unmarshal(kv.Value, fe); err != nil {
+				return err
+			}
+			message, err := unmarshalMessage(fe.Data)
+			if err != nil {
+				return err
+			}
+			err = fn(&Event{
+				PersistenceID: persistenceID,
+				SeqNr:         fe.SeqNr,
+				Message:       message,
+				Tags:          fe.Tags,
+				Timestamp:     fe.Timestamp,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if !resp.More {
+			return nil
+		}
+		key = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
+func (j *etcdJournal) HighestSeqNr(ctx context.Context, persistenceID string) (uint64, error) {
+	resp, err := j.client.Get(ctx, j.highestKey(persistenceID))
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	var highest uint64
+	if _, err := fmt.Sscan(string(resp.Kvs[0].Value), &highest); err != nil {
+		return 0, err
+	}
+	return highest, nil
+}
+
+func (j *etcdJournal) DeleteEvents(ctx context.Context, persistenceID string, seqNr uint64) error {
+	_, err := j.client.Delete(ctx, j.eventsPrefix(persistenceID), clientv3.WithRange(j.eventKey(persistenceID, seqNr+1)))
+	return err
+}
+
+type etcdSnapshotStore struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// NewEtcdSnapshotStore returns a SnapshotStore keeping snapshots under prefix
+// in etcd, a snapshot must fit in a single etcd value.
+func NewEtcdSnapshotStore(client *clientv3.Client, prefix string) SnapshotStore {
+	return &etcdSnapshotStore{client: client, prefix: strings.TrimSuffix(prefix, "/") + "/snapshots/"}
+}
+
+func (s *etcdSnapshotStore) key(persistenceID string) string {
+	return s.prefix + url.PathEscape(persistenceID)
+}
+
+func (s *etcdSnapshotStore) SaveSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	data, err := marshalMessage(snapshot.State)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(&fileSnapshot{SeqNr: snapshot.SeqNr, Timestamp: snapshot.Timestamp, Data: data})
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Put(ctx, s.key(snapshot.PersistenceID), string(b))
+	return err
+}
+
+func (s *etcdSnapshotStore) LoadSnapshot(ctx context.Context, persistenceID string) (*Snapshot, bool, error) {
+	resp, err := s.client.Get(ctx, s.key(persistenceID))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, false, nil
+	}
+
+	fs := &fileSnapshot{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, fs); err != nil {
+		return nil, false, err
+	}
+	state, err := unmarshalMessage(fs.Data)
+	if err != nil {
+		return nil, false, err
+	}
+	return &Snapshot{PersistenceID: persistenceID, SeqNr: fs.SeqNr, State: state, Timestamp: fs.Timestamp}, true, nil
+}
+
+func (s *etcdSnapshotStore) DeleteSnapshot(ctx context.Context, persistenceID string) error {
+	_, err := s.client.Delete(ctx, s.key(persistenceID))
+	return err
+}
+
+// NewEtcdProvider returns a Provider keeping events and snapshots under prefix
+// in etcd.
+func NewEtcdProvider(client *clientv3.Client, prefix string) *Provider {
+	return &Provider{Journal: NewEtcdJournal(client, prefix), Snapshots: NewEtcdSnapshotStore(client, prefix)}
+}
+
+type etcdStateStore struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// NewEtcdStateStore returns a StateStore keeping states under prefix in etcd,
+// the version of a state is the revision of its key.
+func NewEtcdStateStore(client *clientv3.Client, prefix string) StateStore {
+	return &etcdStateStore{client: client, prefix: strings.TrimSuffix(prefix, "/") + "/states/"}
+}
+
+func (s *etcdStateStore) key(id string) string {
+	return s.prefix + url.PathEscape(id)
+}
+
+func (s *etcdStateStore) LoadState(ctx context.Context, id string) (proto.Message, uint64, error) {
+	resp, err := s.client.Get(ctx, s.key(id))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, nil
+	}
+
+	state, err := unmarshalMessage(resp.Kvs[0].Value)
+	if err != nil {
+		return nil, 0, err
+	}
+	return state, uint64(resp.Kvs[0].ModRevision), nil
+}
+
+func (s *etcdStateStore) SaveState(ctx context.Context, id string, state proto.Message, version uint64) (uint64, error) {
+	data, err := marshalMessage(state)
+	if err != nil {
+		return 0, err
+	}
+
+	key := s.key(id)
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", int64(version))).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, ErrVersionConflict
+	}
+	return uint64(resp.Header.Revision), nil
+}
+
+func (s *etcdStateStore) DeleteState(ctx context.Context, id string) error {
+	_, err := s.client.Delete(ctx, s.key(id))
+	return err
+}
@@ -0,0 +1,244 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/internal/fileutil"
+)
+
+type fileEvent struct {
+	SeqNr     uint64    `json:"seqNr"`
+	Tags      []string  `json:"tags,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      []byte    `json:"data"`
+}
+
+type fileJournal struct {
+	dir string
+
+	mu      sync.Mutex
+	highest map[string]uint64
+}
+
+// NewFileJournal returns a Journal appending the events of every persistence
+// id as JSON lines to a file under dir.
+func NewFileJournal(dir string) (Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileJournal{dir: dir, highest: make(map[string]uint64)}, nil
+}
+
+func (j *fileJournal) path(persistenceID string) string {
+	return filepath.Join(j.dir, url.PathEscape(persistenceID)+".journal")
+}
+
+func (j *fileJournal) WriteEvents(ctx context.Context, events []*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	id := events[0].PersistenceID
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	highest, err := j.highestSeqNr(id)
+	if err != nil {
+		return err
+	}
+	if events[0].SeqNr != highest+1 {
+		return ErrSeqNrConflict
+	}
+
+	var b []byte
+	for _, e := range events {
+		data, err := marshalMessage(e.Message)
+		if err != nil {
+			return err
+		}
+		line, err := json.Marshal(&fileEvent{SeqNr: e.SeqNr, Tags: e.Tags, Timestamp: e.Timestamp, Data: data})
+		if err != nil {
+			return err
+		}
+		b = append(append(b, line...), '\n')
+	}
+
+	// The events are written with a single write, so that a crash tears the
+	// last line at most.
+	if err := fileutil.AppendFile(j.path(id), b); err != nil {
+		return err
+	}
+	j.highest[id] = events[len(events)-1].SeqNr
+	return nil
+}
+
+// highestSeqNr returns the highest sequence number of persistenceID, reading
+// its file the first time, j.mu must be held.
+func (j *fileJournal) highestSeqNr(persistenceID string) (uint64, error) {
+	if highest, ok := j.highest[persistenceID]; ok {
+		return highest, nil
+	}
+
+	var highest uint64
+	err := j.scan(persistenceID, func(e *fileEvent) error {
+		highest = e.SeqNr
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Deleting events keeps the highest sequence number in a marker file.
+	if b, err := os.ReadFile(j.path(persistenceID) + ".highest"); err == nil {
+		var deleted uint64
+		if json.Unmarshal(b, &deleted) == nil && deleted > highest {
+			highest = deleted
+		}
+	}
+	j.highest[persistenceID] = highest
+	return highest, nil
+}
+
+// scan calls fn with the events of persistenceID in order.
+func (j *fileJournal) scan(persistenceID string, fn func(e *fileEvent) error) error {
+	path := j.path(persistenceID)
+	return fileutil.ReadLines(path, func(line []byte) error {
+		e := &fileEvent{}
+		if err := json.Unmarshal(line, e); err != nil {
+			return fmt.Errorf("persistence: corrupted event in %s: %w", path, err)
+		}
+		return fn(e)
+	})
+}
+
+func (j *fileJournal) ReadEvents(ctx context.Context, persistenceID string, from uint64, to uint64, fn func(e *Event) error) error {
+	return j.scan(persistenceID, func(fe *fileEvent) error {
+		if fe.SeqNr < from || fe.SeqNr > to {
+			return nil
+		}
+		message, err := unmarshalMessage(fe.Data)
+		if err != nil {
+			return err
+		}
+		return fn(&Event{
+			PersistenceID: persistenceID,
+			SeqNr:         fe.SeqNr,
+			Message:       message,
+			Tags:          fe.Tags,
+			Timestamp:     fe.Timestamp,
+		})
+	})
+}
+
+func (j *fileJournal) HighestSeqNr(ctx context.Context, persistenceID string) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.highestSeqNr(persistenceID)
+}
+
+func (j *fileJournal) DeleteEvents(ctx context.Context, persistenceID string, seqNr uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	highest, err := j.highestSeqNr(persistenceID)
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	err = j.scan(persistenceID, func(e *fileEvent) error {
+		if e.SeqNr <= seqNr {
+			return nil
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, line...), '\n')
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	marker, err := json.Marshal(highest)
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteFile(j.path(persistenceID)+".highest", marker); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(j.path(persistenceID), b)
+}
+
+type fileSnapshot struct {
+	SeqNr     uint64    `json:"seqNr"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      []byte    `json:"data"`
+}
+
+type fileSnapshotStore struct {
+	dir string
+}
+
+// NewFileSnapshotStore returns a SnapshotStore keeping the snapshot of every
+// persistence id in a JSON file under dir.
+func NewFileSnapshotStore(dir string) (SnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileSnapshotStore{dir: dir}, nil
+}
+
+func (s *fileSnapshotStore) path(persistenceID string) string {
+	return filepath.Join(s.dir, url.PathEscape(persistenceID)+".snapshot")
+}
+
+func (s *fileSnapshotStore) SaveSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	data, err := marshalMessage(snapshot.State)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(&fileSnapshot{SeqNr: snapshot.SeqNr, Timestamp: snapshot.Timestamp, Data: data})
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(s.path(snapshot.PersistenceID), b)
+}
+
+func (s *fileSnapshotStore) LoadSnapshot(ctx context.Context, persistenceID string) (*Snapshot, bool, error) {
+	b, err := os.ReadFile(s.path(persistenceID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	fs := &fileSnapshot{}
+	if err := json.Unmarshal(b, fs); err != nil {
+		return nil, false, err
+	}
+	state, err := unmarshalMessage(fs.Data)
+	if err != nil {
+		return nil, false, err
+	}
+	return &Snapshot{PersistenceID: persistenceID, SeqNr: fs.SeqNr, State: state, Timestamp: fs.Timestamp}, true, nil
+}
+
+func (s *fileSnapshotStore) DeleteSnapshot(ctx context.Context, persistenceID string) error {
+	err := os.Remove(s.path(persistenceID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,237 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/remote"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// ErrSeqNrConflict is returned by WriteEvents when an event with the same
+// sequence number has already been written, i.e. when two actors with the
+// same persistence id are alive at the same time.
+var ErrSeqNrConflict = errors.New("persistence: sequence number conflict")
+
+// ErrBatchTooLarge is returned by WriteEvents when the journal cannot write
+// so many events at once, none of them has been written.
+var ErrBatchTooLarge = errors.New("persistence: too many events in a batch")
+
+type Event struct {
+	PersistenceID string
+	SeqNr         uint64
+	Message       proto.Message
+	Tags          []string
+	Timestamp     time.Time
+	// Offset orders the events of all the persistence ids, it is only set
+	// by journals implementing EventsByTagQuery.
+	Offset uint64
+}
+
+type Snapshot struct {
+	PersistenceID string
+	// SeqNr is the sequence number of the last event included in the state.
+	SeqNr     uint64
+	State     proto.Message
+	Timestamp time.Time
+}
+
+// Journal stores the events of persistent actors.
+type Journal interface {
+	// WriteEvents atomically appends events, which belong to a single
+	// persistence id and follow its highest sequence number.
+	WriteEvents(ctx context.Context, events []*Event) error
+	// ReadEvents calls fn with the events of persistenceID whose sequence
+	// number is between from and to inclusive, in order.
+	ReadEvents(ctx context.Context, persistenceID string, from uint64, to uint64, fn func(e *Event) error) error
+	HighestSeqNr(ctx context.Context, persistenceID string) (uint64, error)
+	// DeleteEvents deletes the events up to seqNr inclusive, the highest
+	// sequence number is kept.
+	DeleteEvents(ctx context.Context, persistenceID string, seqNr uint64) error
+}
+
+// EventsByTagQuery is implemented by journals that can read the events of all
+// the persistence ids by tag, as projections do.
+type EventsByTagQuery interface {
+	// EventsByTag calls fn with at most limit events tagged with tag whose
+	// offset is greater than offset, in offset order.
+	EventsByTag(ctx context.Context, tag string, offset uint64, limit int, fn func(e *Event) error) error
+}
+
+// SnapshotStore stores the latest snapshot of persistent actors.
+type SnapshotStore interface {
+	SaveSnapshot(ctx context.Context, s *Snapshot) error
+	LoadSnapshot(ctx context.Context, persistenceID string) (*Snapshot, bool, error)
+	DeleteSnapshot(ctx context.Context, persistenceID string) error
+}
+
+func marshalMessage(m proto.Message) ([]byte, error) {
+	data, err := remote.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(data)
+}
+
+func unmarshalMessage(b []byte) (proto.Message, error) {
+	data := &anypb.Any{}
+	if err := proto.Unmarshal(b, data); err != nil {
+		return nil, err
+	}
+	return remote.Unmarshal(data)
+}
+
+type memoryJournal struct {
+	mu      sync.RWMutex
+	events  map[string][]*Event
+	highest map[string]uint64
+	// all holds the events of every persistence id by offset.
+	all    []*Event
+	offset uint64
+}
+
+// NewMemoryJournal returns a Journal that does not survive restarts. It
+// implements EventsByTagQuery.
+func NewMemoryJournal() Journal {
+	return &memoryJournal{events: make(map[string][]*Event), highest: make(map[string]uint64)}
+}
+
+func (j *memoryJournal) WriteEvents(ctx context.Context, events []*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	id := events[0].PersistenceID
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if events[0].SeqNr != j.highest[id]+1 {
+		return ErrSeqNrConflict
+	}
+	for _, e := range events {
+		j.offset++
+		c := *e
+		c.Message = proto.Clone(e.Message)
+		c.Offset = j.offset
+		j.events[id] = append(j.events[id], &c)
+		j.all = append(j.all, &c)
+	}
+	j.highest[id] = events[len(events)-1].SeqNr
+	return nil
+}
+
+func (j *memoryJournal) ReadEvents(ctx context.Context, persistenceID string, from uint64, to uint64, fn func(e *Event) error) error {
+	j.mu.RLock()
+	events := j.events[persistenceID]
+	j.mu.RUnlock()
+
+	i := sort.Search(len(events), func(i int) bool { return events[i].SeqNr >= from })
+	for ; i < len(events) && events[i].SeqNr <= to; i++ {
+		c := *events[i]
+		c.Message = proto.Clone(events[i].Message)
+		if err := fn(&c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *memoryJournal) HighestSeqNr(ctx context.Context, persistenceID string) (uint64, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	return j.highest[persistenceID], nil
+}
+
+func (j *memoryJournal) DeleteEvents(ctx context.Context, persistenceID string, seqNr uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	events := j.events[persistenceID]
+	i := sort.Search(len(events), func(i int) bool { return events[i].SeqNr > seqNr })
+	j.events[persistenceID] = append([]*Event(nil), events[i:]...)
+
+	all := make([]*Event, 0, len(j.all))
+	for _, e := range j.all {
+		if e.PersistenceID != persistenceID || e.SeqNr > seqNr {
+			all = append(all, e)
+		}
+	}
+	j.all = all
+	return nil
+}
+
+func (j *memoryJournal) EventsByTag(ctx context.Context, tag string, offset uint64, limit int, fn func(e *Event) error) error {
+	j.mu.RLock()
+	all := j.all
+	j.mu.RUnlock()
+
+	i := sort.Search(len(all), func(i int) bool { return all[i].Offset > offset })
+	for n := 0; i < len(all) && n < limit; i++ {
+		if !hasTag(all[i].Tags, tag) {
+			continue
+		}
+		c := *all[i]
+		c.Message = proto.Clone(all[i].Message)
+		if err := fn(&c); err != nil {
+			return err
+		}
+		n++
+	}
+	return nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+type memorySnapshotStore struct {
+	mu        sync.RWMutex
+	snapshots map[string]*Snapshot
+}
+
+// NewMemorySnapshotStore returns a SnapshotStore that does not survive
+// restarts.
+func NewMemorySnapshotStore() SnapshotStore {
+	return &memorySnapshotStore{snapshots: make(map[string]*Snapshot)}
+}
+
+func (s *memorySnapshotStore) SaveSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *snapshot
+	c.State = proto.Clone(snapshot.State)
+	s.snapshots[snapshot.PersistenceID] = &c
+	return nil
+}
+
+func (s *memorySnapshotStore) LoadSnapshot(ctx context.Context, persistenceID string) (*Snapshot, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot, ok := s.snapshots[persistenceID]
+	if !ok {
+		return nil, false, nil
+	}
+	c := *snapshot
+	c.State = proto.Clone(snapshot.State)
+	return &c, true, nil
+}
+
+func (s *memorySnapshotStore) DeleteSnapshot(ctx context.Context, persistenceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.snapshots, persistenceID)
+	return nil
+}
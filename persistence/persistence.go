@@ -0,0 +1,287 @@
+// Package persistence makes actors event sourced: an actor persists the
+// events that change its state, and replays them when it starts again.
+//
+// A persistent actor embeds Mixin, implements PersistentActor and is spawned
+// wrapped with NewActor:
+//
+//	node.SpawnActor(persistence.NewActor(provider, &account{id: "42"}))
+//
+// When the actor starts, it receives *actor.Started, then the latest snapshot
+// as *SnapshotOffer if there is one, then the events persisted after it, and
+// finally *RecoveryCompleted. Recovery happens while handling Started, so no
+// other message is handled before it has completed.
+//
+// Actors that only need their latest state embed StateMixin instead, implement
+// StatefulActor and are spawned wrapped with NewStatefulActor. Their state is
+// loaded before they handle *actor.Started and stored by SaveState.
+package persistence
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/geniuscirno/go-actor/actor"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrRecovering  = errors.New("persistence: actor is recovering")
+	ErrWriteFailed = errors.New("persistence: actor stopped after a failed write")
+)
+
+// Provider holds the stores used by persistent actors.
+type Provider struct {
+	Journal   Journal
+	Snapshots SnapshotStore
+}
+
+func NewMemoryProvider() *Provider {
+	return &Provider{Journal: NewMemoryJournal(), Snapshots: NewMemorySnapshotStore()}
+}
+
+// SnapshotOffer is received during recovery with the latest snapshot.
+type SnapshotOffer struct {
+	SeqNr    uint64
+	Snapshot proto.Message
+}
+
+// RecoveryCompleted is received once all the events have been replayed.
+type RecoveryCompleted struct {
+	SeqNr uint64
+}
+
+type PersistentActor interface {
+	actor.Actor
+	PersistenceID() string
+	SeqNr() uint64
+	init(ctx context.Context, provider *Provider, persistenceID string, tagger EventTagger, stop func())
+	setRecovering(recovering bool)
+	setSeqNr(seqNr uint64)
+}
+
+// EventTagger is implemented by persistent actors tagging the events they
+// persist, projections select events by tag.
+type EventTagger interface {
+	EventTags(event proto.Message) []string
+}
+
+// Mixin is embedded in persistent actors.
+type Mixin struct {
+	provider      *Provider
+	persistenceID string
+	tagger        EventTagger
+	ctx           context.Context
+	stop          func()
+	seqNr         uint64
+	recovering    bool
+	failed        bool
+}
+
+func (m *Mixin) init(ctx context.Context, provider *Provider, persistenceID string, tagger EventTagger, stop func()) {
+	m.provider = provider
+	m.persistenceID = persistenceID
+	m.tagger = tagger
+	m.ctx = ctx
+	m.stop = stop
+}
+
+func (m *Mixin) setRecovering(recovering bool) {
+	m.recovering = recovering
+}
+
+func (m *Mixin) setSeqNr(seqNr uint64) {
+	m.seqNr = seqNr
+}
+
+// Recovering reports whether the message being handled is a replayed event.
+func (m *Mixin) Recovering() bool {
+	return m.recovering
+}
+
+// SeqNr returns the sequence number of the last persisted or replayed event.
+func (m *Mixin) SeqNr() uint64 {
+	return m.seqNr
+}
+
+// Persist writes event to the journal, then calls handler with it to update
+// the state. The handler is not called if the event could not be written.
+func (m *Mixin) Persist(event proto.Message, handler func(event proto.Message)) error {
+	return m.PersistAll([]proto.Message{event}, handler)
+}
+
+// PersistAll atomically writes events to the journal, then calls handler
+// with each of them.
+//
+// If the events could not be written the actor is stopped: the write may
+// have succeeded anyway, and the state is only known again once the actor has
+// been spawned again and recovered from the journal. Later calls return
+// ErrWriteFailed. ErrBatchTooLarge is returned without stopping the actor,
+// nothing having been written.
+func (m *Mixin) PersistAll(events []proto.Message, handler func(event proto.Message)) error {
+	if m.recovering {
+		return ErrRecovering
+	}
+	if m.failed {
+		return ErrWriteFailed
+	}
+
+	now := time.Now()
+	entries := make([]*Event, 0, len(events))
+	for i, e := range events {
+		var tags []string
+		if m.tagger != nil {
+			tags = m.tagger.EventTags(e)
+		}
+		entries = append(entries, &Event{
+			PersistenceID: m.persistenceID,
+			SeqNr:         m.seqNr + uint64(i) + 1,
+			Message:       e,
+			Tags:          tags,
+			Timestamp:     now,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, time.Second*5)
+	defer cancel()
+	if err := m.provider.Journal.WriteEvents(ctx, entries); err != nil {
+		if errors.Is(err, ErrBatchTooLarge) {
+			return err
+		}
+		log.Printf("persistence: write events of %s failed, stopping: %v\n", m.persistenceID, err)
+		m.failed = true
+		m.stop()
+		return err
+	}
+	for _, e := range entries {
+		m.seqNr = e.SeqNr
+		if handler != nil {
+			handler(e.Message)
+		}
+	}
+	return nil
+}
+
+// SaveSnapshot stores state as the state after the last persisted event, the
+// next recovery starts from it.
+func (m *Mixin) SaveSnapshot(state proto.Message) error {
+	ctx, cancel := context.WithTimeout(m.ctx, time.Second*5)
+	defer cancel()
+	return m.provider.Snapshots.SaveSnapshot(ctx, &Snapshot{
+		PersistenceID: m.persistenceID,
+		SeqNr:         m.seqNr,
+		State:         state,
+		Timestamp:     time.Now(),
+	})
+}
+
+// DeleteEvents deletes the events up to seqNr, usually the sequence number of
+// a snapshot that has been saved.
+func (m *Mixin) DeleteEvents(seqNr uint64) error {
+	ctx, cancel := context.WithTimeout(m.ctx, time.Second*5)
+	defer cancel()
+	return m.provider.Journal.DeleteEvents(ctx, m.persistenceID, seqNr)
+}
+
+type persistentActor struct {
+	provider *Provider
+	actor    PersistentActor
+	failed   bool
+}
+
+// NewActor returns an actor recovering a from provider when it starts.
+func NewActor(provider *Provider, a PersistentActor) actor.Actor {
+	return &persistentActor{provider: provider, actor: a}
+}
+
+func (p *persistentActor) Receive(c actor.Context) {
+	if p.failed {
+		return
+	}
+
+	switch c.Message().(type) {
+	case *actor.Started:
+		tagger, _ := p.actor.(EventTagger)
+		p.actor.init(c.Context(), p.provider, p.actor.PersistenceID(), tagger, func() {
+			p.failed = true
+			c.Kill()
+		})
+		p.actor.Receive(c)
+		if err := p.recover(c); err != nil {
+			// Handling messages with a partly recovered state could
+			// persist wrong events, the actor is stopped instead.
+			log.Printf("persistence: recover %s failed: %v\n", p.actor.PersistenceID(), err)
+			p.failed = true
+			c.Kill()
+		}
+	default:
+		p.actor.Receive(c)
+	}
+}
+
+func (p *persistentActor) recover(c actor.Context) error {
+	id := p.actor.PersistenceID()
+	ctx := c.Context()
+
+	p.actor.setRecovering(true)
+	defer p.actor.setRecovering(false)
+
+	var from uint64
+	snapshot, ok, err := p.provider.Snapshots.LoadSnapshot(ctx, id)
+	if err != nil {
+		return err
+	}
+	if ok {
+		from = snapshot.SeqNr
+		p.actor.setSeqNr(snapshot.SeqNr)
+		p.actor.Receive(&recoveryContext{embeddedContext: c, message: &SnapshotOffer{SeqNr: snapshot.SeqNr, Snapshot: snapshot.State}})
+	}
+
+	err = p.provider.Journal.ReadEvents(ctx, id, from+1, ^uint64(0), func(e *Event) error {
+		p.actor.setSeqNr(e.SeqNr)
+		p.actor.Receive(&recoveryContext{embeddedContext: c, message: e.Message})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Events may have been deleted up to a snapshot that has been lost,
+	// numbering continues after the highest one anyway.
+	highest, err := p.provider.Journal.HighestSeqNr(ctx, id)
+	if err != nil {
+		return err
+	}
+	if highest > p.actor.SeqNr() {
+		p.actor.setSeqNr(highest)
+	}
+
+	p.actor.setRecovering(false)
+	p.actor.Receive(&recoveryContext{embeddedContext: c, message: &RecoveryCompleted{SeqNr: p.actor.SeqNr()}})
+	return nil
+}
+
+type embeddedContext = actor.Context
+
+// recoveryContext delivers the recovery messages, which are not replied to.
+type recoveryContext struct {
+	embeddedContext
+	message interface{}
+}
+
+func (c *recoveryContext) Message() interface{} {
+	return c.message
+}
+
+func (c *recoveryContext) Reply(message interface{}) error {
+	return nil
+}
+
+func (c *recoveryContext) Error(err error) error {
+	return nil
+}
+
+func (c *recoveryContext) From() actor.PID {
+	return actor.ZeroPID
+}
@@ -0,0 +1,352 @@
+// Package projection builds read sides from the events of the journal. A
+// Projection tails the events of some tags, usually the slices of a tag spread
+// with SliceTag, and calls a handler with every event at least once:
+//
+//	func (a *account) EventTags(event proto.Message) []string {
+//		return []string{projection.SliceTag("accounts", a.PersistenceID(), 8)}
+//	}
+//
+//	p := projection.New("balances", journal, offsets, locker,
+//		projection.SliceTags("accounts", 8), handler,
+//		projection.WithMembers(c, node.Name()))
+//	p.Start()
+//
+// Every slice is processed by a single node at a time, the one holding its
+// lock. The context of a handler is cancelled when the lock is lost, the
+// handler must not go on with it. With WithMembers, the slices are spread
+// over the members of the cluster and each node only competes for the locks
+// of its own slices.
+//
+// The offset of a slice is saved after each batch of events, the events of a
+// batch are handled again if the node stops before, so handlers must be
+// idempotent. The journal must make the events visible in offset order, an
+// event committed after an event with a greater offset may be skipped.
+package projection
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/hashring"
+	"github.com/geniuscirno/go-actor/persistence"
+)
+
+// Handler handles an event, an event is handled again after RetryDelay if the
+// handler returns an error.
+type Handler func(ctx context.Context, e *persistence.Event) error
+
+// Members is the membership of the cluster, *cluster.Cluster implements it.
+type Members interface {
+	Members() []string
+	WatchMembers(f func(members []string)) (cancel func())
+}
+
+type options struct {
+	interval   time.Duration
+	batch      int
+	retryDelay time.Duration
+	members    Members
+	self       string
+}
+
+func defaultOptions() options {
+	return options{
+		interval:   time.Second,
+		batch:      100,
+		retryDelay: time.Second * 5,
+	}
+}
+
+type Option func(*options)
+
+// PollInterval sets how often the journal is read for new events once all
+// the events have been handled.
+func PollInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// BatchSize sets how many events are read at once, the offset is saved after
+// every batch.
+func BatchSize(n int) Option {
+	return func(o *options) {
+		o.batch = n
+	}
+}
+
+func RetryDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.retryDelay = d
+	}
+}
+
+// WithMembers spreads the slices over members, self is the name of this node
+// among them.
+func WithMembers(members Members, self string) Option {
+	return func(o *options) {
+		o.members = members
+		o.self = self
+	}
+}
+
+// SliceTag returns the tag of the slice of persistenceID among slices tags
+// starting with prefix.
+func SliceTag(prefix string, persistenceID string, slices int) string {
+	h := fnv.New32a()
+	h.Write([]byte(persistenceID))
+	return fmt.Sprintf("%s-%d", prefix, h.Sum32()%uint32(slices))
+}
+
+// SliceTags returns the tags of the slices returned by SliceTag.
+func SliceTags(prefix string, slices int) []string {
+	tags := make([]string, 0, slices)
+	for i := 0; i < slices; i++ {
+		tags = append(tags, fmt.Sprintf("%s-%d", prefix, i))
+	}
+	return tags
+}
+
+type Projection struct {
+	name    string
+	opts    options
+	journal persistence.EventsByTagQuery
+	offsets OffsetStore
+	locker  Locker
+	tags    []string
+	handler Handler
+
+	mu      sync.Mutex
+	ring    *hashring.Ring
+	changed chan struct{}
+	cancelW func()
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(name string, journal persistence.EventsByTagQuery, offsets OffsetStore, locker Locker, tags []string, handler Handler, opt ...Option) *Projection {
+	opts := defaultOptions()
+	for _, o := range opt {
+		o(&opts)
+	}
+	p := &Projection{
+		name:    name,
+		opts:    opts,
+		journal: journal,
+		offsets: offsets,
+		locker:  locker,
+		tags:    tags,
+		handler: handler,
+		changed: make(chan struct{}),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	return p
+}
+
+func (p *Projection) Start() {
+	if p.opts.members != nil {
+		p.cancelW = p.opts.members.WatchMembers(func(members []string) {
+			p.updateMembers(members)
+		})
+		p.updateMembers(p.opts.members.Members())
+	}
+
+	for _, tag := range p.tags {
+		p.wg.Add(1)
+		go func(tag string) {
+			defer p.wg.Done()
+			p.run(tag)
+		}(tag)
+	}
+}
+
+// Stop stops processing and releases the locks of the slices, the events
+// being handled complete first.
+func (p *Projection) Stop() {
+	if p.cancelW != nil {
+		p.cancelW()
+	}
+	p.cancel()
+	p.wg.Wait()
+}
+
+func (p *Projection) updateMembers(members []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ring = hashring.New(100, members...)
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// owns reports whether this node should process tag, and returns a channel
+// closed when the members change.
+func (p *Projection) owns(tag string) (bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.opts.members == nil {
+		return true, p.changed
+	}
+	owner, ok := p.ring.Get(p.name + "/" + tag)
+	return ok && owner == p.opts.self, p.changed
+}
+
+func (p *Projection) run(tag string) {
+	key := p.name + "/" + tag
+	for p.ctx.Err() == nil {
+		owned, changed := p.owns(tag)
+		if !owned {
+			select {
+			case <-p.ctx.Done():
+			case <-changed:
+			}
+			continue
+		}
+
+		// The lock is given up as soon as the slice belongs to another
+		// node, so that the new owner takes it over.
+		ctx, cancel := context.WithCancel(p.ctx)
+		go func(changed <-chan struct{}) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-changed:
+				}
+				var owned bool
+				if owned, changed = p.owns(tag); !owned {
+					cancel()
+					return
+				}
+			}
+		}(changed)
+
+		lost, err := p.locker.Lock(ctx, key)
+		if err != nil {
+			cancel()
+			if p.ctx.Err() == nil && ctx.Err() == nil {
+				log.Printf("projection: lock %s failed: %v\n", key, err)
+				p.sleep(p.opts.retryDelay)
+			}
+			continue
+		}
+		// The handlers stop with ctx as soon as the lock is lost, the
+		// new owner may be processing the slice from then on.
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-lost:
+				cancel()
+			}
+		}()
+		log.Printf("projection: processing %s\n", key)
+		p.process(ctx, tag, lost)
+		cancel()
+
+		unlockCtx, unlockCancel := context.WithTimeout(context.Background(), time.Second*5)
+		if err := p.locker.Unlock(unlockCtx, key); err != nil {
+			log.Printf("projection: unlock %s failed: %v\n", key, err)
+		}
+		unlockCancel()
+	}
+}
+
+// process handles the events of tag until ctx is done or the lock is lost.
+func (p *Projection) process(ctx context.Context, tag string, lost <-chan struct{}) {
+	offset, err := p.offsets.LoadOffset(ctx, p.name, tag)
+	for err != nil {
+		log.Printf("projection: load offset of %s/%s failed: %v\n", p.name, tag, err)
+		if !p.wait(ctx, lost, p.opts.retryDelay) {
+			return
+		}
+		offset, err = p.offsets.LoadOffset(ctx, p.name, tag)
+	}
+
+	for {
+		n, next, err := p.handleBatch(ctx, tag, offset, lost)
+		if next != offset && !closed(lost) {
+			// Saved even if processing is stopping as long as the lock is
+			// held, the next owner would handle the events again otherwise.
+			// Once the lock is lost, the save could overwrite the offset of
+			// the next owner.
+			saveCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			if serr := p.offsets.SaveOffset(saveCtx, p.name, tag, next); serr != nil {
+				log.Printf("projection: save offset of %s/%s failed: %v\n", p.name, tag, serr)
+			} else {
+				offset = next
+			}
+			cancel()
+		}
+
+		delay := time.Duration(0)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("projection: handle %s/%s failed: %v\n", p.name, tag, err)
+			delay = p.opts.retryDelay
+		} else if n < p.opts.batch {
+			delay = p.opts.interval
+		}
+		if !p.wait(ctx, lost, delay) {
+			return
+		}
+	}
+}
+
+// handleBatch handles the events following offset, and returns how many
+// events were read and the offset of the last one handled.
+func (p *Projection) handleBatch(ctx context.Context, tag string, offset uint64, lost <-chan struct{}) (int, uint64, error) {
+	var n int
+	err := p.journal.EventsByTag(ctx, tag, offset, p.opts.batch, func(e *persistence.Event) error {
+		select {
+		case <-lost:
+			return context.Canceled
+		default:
+		}
+
+		n++
+		if err := p.handler(ctx, e); err != nil {
+			return err
+		}
+		offset = e.Offset
+		return nil
+	})
+	return n, offset, err
+}
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait waits for d, it reports false if processing must stop.
+func (p *Projection) wait(ctx context.Context, lost <-chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-lost:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (p *Projection) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-p.ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,202 @@
+package projection
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// OffsetStore keeps the offset of the last event handled by a projection in
+// every tag slice.
+type OffsetStore interface {
+	// LoadOffset returns 0 if no offset has been saved.
+	LoadOffset(ctx context.Context, projection string, tag string) (uint64, error)
+	SaveOffset(ctx context.Context, projection string, tag string, offset uint64) error
+}
+
+// Locker grants a node the exclusive processing of a tag slice.
+type Locker interface {
+	// Lock blocks until this node holds key, the returned channel is closed
+	// once the lock is lost.
+	Lock(ctx context.Context, key string) (<-chan struct{}, error)
+	Unlock(ctx context.Context, key string) error
+}
+
+type memoryOffsetStore struct {
+	mu      sync.Mutex
+	offsets map[string]uint64
+}
+
+// NewMemoryOffsetStore returns an OffsetStore for a single node, the
+// projections start over after a restart.
+func NewMemoryOffsetStore() OffsetStore {
+	return &memoryOffsetStore{offsets: make(map[string]uint64)}
+}
+
+func (s *memoryOffsetStore) LoadOffset(ctx context.Context, projection string, tag string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.offsets[projection+"/"+tag], nil
+}
+
+func (s *memoryOffsetStore) SaveOffset(ctx context.Context, projection string, tag string, offset uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offsets[projection+"/"+tag] = offset
+	return nil
+}
+
+type etcdOffsetStore struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// NewEtcdOffsetStore returns an OffsetStore keeping offsets under prefix in
+// etcd.
+func NewEtcdOffsetStore(client *clientv3.Client, prefix string) OffsetStore {
+	return &etcdOffsetStore{client: client, prefix: strings.TrimSuffix(prefix, "/") + "/offsets/"}
+}
+
+func (s *etcdOffsetStore) key(projection string, tag string) string {
+	return s.prefix + url.PathEscape(projection) + "/" + url.PathEscape(tag)
+}
+
+func (s *etcdOffsetStore) LoadOffset(ctx context.Context, projection string, tag string) (uint64, error) {
+	resp, err := s.client.Get(ctx, s.key(projection, tag))
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	var offset uint64
+	if _, err := fmt.Sscan(string(resp.Kvs[0].Value), &offset); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+func (s *etcdOffsetStore) SaveOffset(ctx context.Context, projection string, tag string, offset uint64) error {
+	_, err := s.client.Put(ctx, s.key(projection, tag), fmt.Sprint(offset))
+	return err
+}
+
+type localLocker struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+// LocalLocker grants locks among the projections of this process, for
+// projections running on a single node.
+func LocalLocker() Locker {
+	return &localLocker{locks: make(map[string]chan struct{})}
+}
+
+func (l *localLocker) lock(key string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		l.locks[key] = lock
+	}
+	return lock
+}
+
+func (l *localLocker) Lock(ctx context.Context, key string) (<-chan struct{}, error) {
+	select {
+	case l.lock(key) <- struct{}{}:
+		return make(chan struct{}), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *localLocker) Unlock(ctx context.Context, key string) error {
+	select {
+	case <-l.lock(key):
+	default:
+	}
+	return nil
+}
+
+type etcdLocker struct {
+	client *clientv3.Client
+	prefix string
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	session *concurrency.Session
+	mutexes map[string]*concurrency.Mutex
+}
+
+// NewEtcdLocker grants locks under prefix in etcd with a session lease of ttl,
+// a lock is released at the latest ttl after its node has died.
+func NewEtcdLocker(client *clientv3.Client, prefix string, ttl time.Duration) Locker {
+	return &etcdLocker{
+		client:  client,
+		prefix:  strings.TrimSuffix(prefix, "/") + "/locks/",
+		ttl:     ttl,
+		mutexes: make(map[string]*concurrency.Mutex),
+	}
+}
+
+// getSession returns the session of the locks, a new one once the previous
+// one has expired. l.mu must be held.
+func (l *etcdLocker) getSession(ctx context.Context) (*concurrency.Session, error) {
+	if l.session != nil {
+		select {
+		case <-l.session.Done():
+			l.session = nil
+		default:
+			return l.session, nil
+		}
+	}
+
+	session, err := concurrency.NewSession(l.client, concurrency.WithTTL(int(l.ttl.Seconds())))
+	if err != nil {
+		return nil, err
+	}
+	l.session = session
+	return session, nil
+}
+
+func (l *etcdLocker) Lock(ctx context.Context, key string) (<-chan struct{}, error) {
+	l.mu.Lock()
+	session, err := l.getSession(ctx)
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	m := concurrency.NewMutex(session, l.prefix+url.PathEscape(key))
+	if err := m.Lock(ctx); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.mutexes[key] = m
+	l.mu.Unlock()
+	return session.Done(), nil
+}
+
+func (l *etcdLocker) Unlock(ctx context.Context, key string) error {
+	l.mu.Lock()
+	m, ok := l.mutexes[key]
+	delete(l.mutexes, key)
+	l.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return m.Unlock(ctx)
+}
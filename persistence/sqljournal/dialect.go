@@ -0,0 +1,62 @@
+package sqljournal
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect holds what differs between the databases, the queries are otherwise
+// plain SQL.
+type Dialect struct {
+	Name string
+	// Placeholder returns the placeholder of the i-th argument of a query,
+	// starting at 1.
+	Placeholder func(i int) string
+	// AutoIncrement is the column definition of the ordering column.
+	AutoIncrement string
+	Blob          string
+	// OrderedCommits reports whether the transactions commit in the order
+	// of the orderings they insert, as with a single writer. Otherwise a
+	// transaction may commit after another one with greater orderings, and
+	// EventsByTag holds the events back until the gaps below them settle.
+	OrderedCommits bool
+}
+
+var (
+	SQLite = &Dialect{
+		Name:           "sqlite",
+		Placeholder:    func(i int) string { return "?" },
+		AutoIncrement:  "INTEGER PRIMARY KEY AUTOINCREMENT",
+		Blob:           "BLOB",
+		OrderedCommits: true,
+	}
+	// ExperimentalMySQL and ExperimentalPostgres have not been run against a
+	// database, only SQLite is tested.
+	ExperimentalMySQL = &Dialect{
+		Name:          "mysql",
+		Placeholder:   func(i int) string { return "?" },
+		AutoIncrement: "BIGINT PRIMARY KEY AUTO_INCREMENT",
+		Blob:          "LONGBLOB",
+	}
+	ExperimentalPostgres = &Dialect{
+		Name:          "postgres",
+		Placeholder:   func(i int) string { return "$" + strconv.Itoa(i) },
+		AutoIncrement: "BIGSERIAL PRIMARY KEY",
+		Blob:          "BYTEA",
+	}
+)
+
+// rebind replaces the ? placeholders of query with the ones of the dialect.
+func (d *Dialect) rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString(d.Placeholder(n))
+	}
+	return b.String()
+}
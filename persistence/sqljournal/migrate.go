@@ -0,0 +1,82 @@
+package sqljournal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations returns the statements creating the schema. They are applied in
+// order and once each, new statements are appended and the existing ones are
+// never changed.
+func migrations(d *Dialect, prefix string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE %sjournal (
+	ordering %s,
+	persistence_id VARCHAR(255) NOT NULL,
+	seq_nr BIGINT NOT NULL,
+	message %s NOT NULL,
+	tags VARCHAR(1024) NOT NULL,
+	created_at BIGINT NOT NULL,
+	UNIQUE (persistence_id, seq_nr)
+)`, prefix, d.AutoIncrement, d.Blob),
+		fmt.Sprintf(`CREATE TABLE %sjournal_tags (
+	tag VARCHAR(255) NOT NULL,
+	ordering BIGINT NOT NULL,
+	PRIMARY KEY (tag, ordering)
+)`, prefix),
+		fmt.Sprintf(`CREATE TABLE %sjournal_highest (
+	persistence_id VARCHAR(255) NOT NULL PRIMARY KEY,
+	seq_nr BIGINT NOT NULL
+)`, prefix),
+		fmt.Sprintf(`CREATE TABLE %ssnapshots (
+	persistence_id VARCHAR(255) NOT NULL PRIMARY KEY,
+	seq_nr BIGINT NOT NULL,
+	state %s NOT NULL,
+	created_at BIGINT NOT NULL
+)`, prefix, d.Blob),
+		fmt.Sprintf(`CREATE TABLE %sprojection_offsets (
+	projection VARCHAR(255) NOT NULL,
+	tag VARCHAR(255) NOT NULL,
+	offset_value BIGINT NOT NULL,
+	PRIMARY KEY (projection, tag)
+)`, prefix),
+	}
+}
+
+// migrate applies the migrations that have not been applied yet, recording
+// each one in the schema_migrations table.
+func migrate(ctx context.Context, db *sql.DB, d *Dialect, prefix string) error {
+	table := prefix + "schema_migrations"
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL PRIMARY KEY)", table)); err != nil {
+		return err
+	}
+
+	var version int
+	if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", table)).Scan(&version); err != nil {
+		return err
+	}
+
+	for i, stmt := range migrations(d, prefix) {
+		if i+1 <= version {
+			continue
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqljournal: migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, d.rebind(fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", table)), i+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqljournal: migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
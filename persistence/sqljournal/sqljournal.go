@@ -0,0 +1,659 @@
+// Package sqljournal implements the persistence journal and snapshot store on
+// top of database/sql. The driver is chosen by the caller, the Dialect adapts
+// the schema and the queries to the database:
+//
+//	db, _ := sql.Open("sqlite3", "journal.db?_busy_timeout=5000&_txlock=immediate")
+//	store, err := sqljournal.Open(db, sqljournal.WithDialect(sqljournal.SQLite))
+//	node.SpawnActor(persistence.NewActor(store.Provider(), &account{id: "42"}))
+//
+// Open creates or upgrades the schema. Events written concurrently by several
+// actors are batched into a single transaction, which is aborted as soon as
+// the context of one of the writes is done. With SQLite, transactions must
+// lock the database when they begin, otherwise concurrent writers fail with
+// "database is locked" instead of waiting. Only the SQLite dialect is tested,
+// the MySQL and Postgres ones are experimental.
+//
+// With MySQL and Postgres, an event may become visible after events with a
+// greater ordering, which a projection would skip. EventsByTag only returns
+// the events below a missing ordering once the event following the gap is
+// older than the gap timeout, see WithGapTimeout.
+package sqljournal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/persistence"
+	"github.com/geniuscirno/go-actor/remote"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+var ErrClosed = errors.New("sqljournal: store is closed")
+
+type options struct {
+	dialect     *Dialect
+	tablePrefix string
+	batchSize   int
+	gapTimeout  time.Duration
+}
+
+type Option func(*options)
+
+// WithDialect sets the dialect of the database, SQLite by default.
+func WithDialect(d *Dialect) Option {
+	return func(o *options) {
+		o.dialect = d
+	}
+}
+
+// WithTablePrefix prefixes the names of the tables.
+func WithTablePrefix(prefix string) Option {
+	return func(o *options) {
+		o.tablePrefix = prefix
+	}
+}
+
+// WithBatchSize sets how many writes may share a transaction, 64 by default.
+// A size of 1 writes every call in its own transaction.
+func WithBatchSize(n int) Option {
+	return func(o *options) {
+		o.batchSize = n
+	}
+}
+
+// WithGapTimeout sets how long after the timestamp of the event following a
+// missing ordering the gap is taken as a rolled back or deleted event, 10
+// seconds by default. It must exceed the time between persisting an event and
+// committing or aborting its transaction, plus the clock skew between the
+// writers. It is ignored by the dialects with OrderedCommits.
+func WithGapTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.gapTimeout = d
+	}
+}
+
+type writeRequest struct {
+	ctx    context.Context
+	events []*persistence.Event
+	result chan error
+}
+
+// Store is a journal and a snapshot store, it also keeps the offsets of
+// projections.
+type Store struct {
+	db   *sql.DB
+	opts options
+	q    queries
+
+	writes    chan *writeRequest
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+var (
+	_ persistence.Journal          = (*Store)(nil)
+	_ persistence.EventsByTagQuery = (*Store)(nil)
+	_ persistence.SnapshotStore    = (*Store)(nil)
+)
+
+// Open migrates the schema of db and returns a Store using it. Closing the
+// Store does not close db.
+func Open(db *sql.DB, opt ...Option) (*Store, error) {
+	opts := options{dialect: SQLite, batchSize: 64, gapTimeout: time.Second * 10}
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	if err := migrate(ctx, db, opts.dialect, opts.tablePrefix); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		db:     db,
+		opts:   opts,
+		q:      newQueries(opts.dialect, opts.tablePrefix),
+		writes: make(chan *writeRequest, opts.batchSize),
+		done:   make(chan struct{}),
+	}
+	if opts.batchSize > 1 {
+		s.wg.Add(1)
+		go s.writeLoop()
+	}
+	return s, nil
+}
+
+// Provider returns a persistence provider using s as journal and snapshot
+// store.
+func (s *Store) Provider() *persistence.Provider {
+	return &persistence.Provider{Journal: s, Snapshots: s}
+}
+
+// Close stops batching the writes, the writes in progress complete first.
+func (s *Store) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+type queries struct {
+	insertEvent    string
+	insertTags     string
+	highestSeqNr   string
+	deletedSeqNr   string
+	readEvents     string
+	eventsByTag    string
+	orderings      string
+	deleteHighest  string
+	insertHighest  string
+	deleteTags     string
+	deleteEvents   string
+	deleteSnapshot string
+	insertSnapshot string
+	loadSnapshot   string
+	loadOffset     string
+	deleteOffset   string
+	insertOffset   string
+}
+
+func newQueries(d *Dialect, prefix string) queries {
+	journal, tags, highest, snapshots, offsets := prefix+"journal", prefix+"journal_tags", prefix+"journal_highest", prefix+"snapshots", prefix+"projection_offsets"
+	return queries{
+		insertEvent:    d.rebind(fmt.Sprintf("INSERT INTO %s (persistence_id, seq_nr, message, tags, created_at) VALUES (?, ?, ?, ?, ?)", journal)),
+		insertTags:     d.rebind(fmt.Sprintf("INSERT INTO %s (tag, ordering) SELECT ?, ordering FROM %s WHERE persistence_id = ? AND seq_nr = ?", tags, journal)),
+		highestSeqNr:   d.rebind(fmt.Sprintf("SELECT COALESCE(MAX(seq_nr), 0) FROM %s WHERE persistence_id = ?", journal)),
+		deletedSeqNr:   d.rebind(fmt.Sprintf("SELECT COALESCE(MAX(seq_nr), 0) FROM %s WHERE persistence_id = ?", highest)),
+		readEvents:     d.rebind(fmt.Sprintf("SELECT ordering, seq_nr, message, tags, created_at FROM %s WHERE persistence_id = ? AND seq_nr >= ? AND seq_nr <= ? ORDER BY seq_nr", journal)),
+		eventsByTag:    d.rebind(fmt.Sprintf("SELECT j.ordering, j.persistence_id, j.seq_nr, j.message, j.tags, j.created_at FROM %s t JOIN %s j ON j.ordering = t.ordering WHERE t.tag = ? AND t.ordering > ? ORDER BY t.ordering LIMIT ?", tags, journal)),
+		orderings:      d.rebind(fmt.Sprintf("SELECT ordering, created_at FROM %s WHERE ordering > ? AND ordering <= ? ORDER BY ordering LIMIT ?", journal)),
+		deleteHighest:  d.rebind(fmt.Sprintf("DELETE FROM %s WHERE persistence_id = ?", highest)),
+		insertHighest:  d.rebind(fmt.Sprintf("INSERT INTO %s (persistence_id, seq_nr) VALUES (?, ?)", highest)),
+		deleteTags:     d.rebind(fmt.Sprintf("DELETE FROM %s WHERE ordering IN (SELECT ordering FROM %s WHERE persistence_id = ? AND seq_nr <= ?)", tags, journal)),
+		deleteEvents:   d.rebind(fmt.Sprintf("DELETE FROM %s WHERE persistence_id = ? AND seq_nr <= ?", journal)),
+		deleteSnapshot: d.rebind(fmt.Sprintf("DELETE FROM %s WHERE persistence_id = ?", snapshots)),
+		insertSnapshot: d.rebind(fmt.Sprintf("INSERT INTO %s (persistence_id, seq_nr, state, created_at) VALUES (?, ?, ?, ?)", snapshots)),
+		loadSnapshot:   d.rebind(fmt.Sprintf("SELECT seq_nr, state, created_at FROM %s WHERE persistence_id = ?", snapshots)),
+		loadOffset:     d.rebind(fmt.Sprintf("SELECT offset_value FROM %s WHERE projection = ? AND tag = ?", offsets)),
+		deleteOffset:   d.rebind(fmt.Sprintf("DELETE FROM %s WHERE projection = ? AND tag = ?", offsets)),
+		insertOffset:   d.rebind(fmt.Sprintf("INSERT INTO %s (projection, tag, offset_value) VALUES (?, ?, ?)", offsets)),
+	}
+}
+
+func marshalMessage(m proto.Message) ([]byte, error) {
+	data, err := remote.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(data)
+}
+
+func unmarshalMessage(b []byte) (proto.Message, error) {
+	data := &anypb.Any{}
+	if err := proto.Unmarshal(b, data); err != nil {
+		return nil, err
+	}
+	return remote.Unmarshal(data)
+}
+
+// clamp converts a sequence number or an offset to an argument, drivers
+// reject uint64 values that do not fit in an int64.
+func clamp(n uint64) int64 {
+	if n > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(n)
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *Store) highestSeqNr(ctx context.Context, q querier, persistenceID string) (uint64, error) {
+	var highest, deleted int64
+	if err := q.QueryRowContext(ctx, s.q.highestSeqNr, persistenceID).Scan(&highest); err != nil {
+		return 0, err
+	}
+	if err := q.QueryRowContext(ctx, s.q.deletedSeqNr, persistenceID).Scan(&deleted); err != nil {
+		return 0, err
+	}
+	if deleted > highest {
+		highest = deleted
+	}
+	return uint64(highest), nil
+}
+
+func (s *Store) WriteEvents(ctx context.Context, events []*persistence.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if s.opts.batchSize <= 1 {
+		return s.write(ctx, [][]*persistence.Event{events})
+	}
+
+	r := &writeRequest{ctx: ctx, events: events, result: make(chan error, 1)}
+	select {
+	case s.writes <- r:
+	case <-s.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// Once queued the result is awaited even if ctx is done: the transaction
+	// is aborted with ctx, but a commit racing with it must not be reported
+	// as a failure.
+	select {
+	case err := <-r.result:
+		return err
+	case <-s.done:
+		// Queued after the loop drained the writes, it is never answered.
+		s.wg.Wait()
+		select {
+		case err := <-r.result:
+			return err
+		default:
+			return ErrClosed
+		}
+	}
+}
+
+// writeLoop writes the requests queued while the previous transaction was
+// running in a single transaction.
+func (s *Store) writeLoop() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.done:
+			for {
+				select {
+				case r := <-s.writes:
+					r.result <- ErrClosed
+				default:
+					return
+				}
+			}
+		case r := <-s.writes:
+			batch := []*writeRequest{r}
+		drain:
+			for len(batch) < s.opts.batchSize {
+				select {
+				case r := <-s.writes:
+					batch = append(batch, r)
+				default:
+					break drain
+				}
+			}
+			s.writeBatch(batch)
+		}
+	}
+}
+
+func (s *Store) writeBatch(batch []*writeRequest) {
+	pending := batch[:0]
+	for _, r := range batch {
+		if err := r.ctx.Err(); err != nil {
+			r.result <- err
+			continue
+		}
+		pending = append(pending, r)
+	}
+
+	if len(pending) > 1 {
+		groups := make([][]*persistence.Event, 0, len(pending))
+		for _, r := range pending {
+			groups = append(groups, r.events)
+		}
+		ctx, cancel := batchContext(pending)
+		err := s.write(ctx, groups)
+		cancel()
+		if err == nil {
+			for _, r := range pending {
+				r.result <- nil
+			}
+			return
+		}
+	}
+
+	// A single failing write, e.g. a conflict, must not fail the others of
+	// the batch, they are retried one by one.
+	for _, r := range pending {
+		r.result <- s.write(r.ctx, [][]*persistence.Event{r.events})
+	}
+}
+
+// batchContext returns a context done as soon as the context of one of the
+// requests is, so that no write commits after its caller has given up.
+func batchContext(batch []*writeRequest) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, r := range batch {
+		go func(rctx context.Context) {
+			select {
+			case <-rctx.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}(r.ctx)
+	}
+	return ctx, cancel
+}
+
+// write writes every group of events in a single transaction.
+func (s *Store) write(ctx context.Context, groups [][]*persistence.Event) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.writeTx(ctx, tx, groups); err != nil {
+		tx.Rollback()
+		if len(groups) == 1 && !errors.Is(err, persistence.ErrSeqNrConflict) {
+			// The unique constraint catches concurrent writers, its error
+			// depends on the driver.
+			if highest, herr := s.highestSeqNr(ctx, s.db, groups[0][0].PersistenceID); herr == nil && highest >= groups[0][0].SeqNr {
+				return persistence.ErrSeqNrConflict
+			}
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) writeTx(ctx context.Context, tx *sql.Tx, groups [][]*persistence.Event) error {
+	for _, events := range groups {
+		id := events[0].PersistenceID
+		highest, err := s.highestSeqNr(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if events[0].SeqNr != highest+1 {
+			return persistence.ErrSeqNrConflict
+		}
+
+		for _, e := range events {
+			message, err := marshalMessage(e.Message)
+			if err != nil {
+				return err
+			}
+			tags, err := json.Marshal(e.Tags)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, s.q.insertEvent, id, clamp(e.SeqNr), message, string(tags), e.Timestamp.UnixNano()); err != nil {
+				return err
+			}
+			for _, tag := range e.Tags {
+				if _, err := tx.ExecContext(ctx, s.q.insertTags, tag, id, clamp(e.SeqNr)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEvent(row scanner, persistenceID string) (*persistence.Event, error) {
+	var (
+		ordering, seqNr, createdAt int64
+		message                    []byte
+		tags                       string
+	)
+	if persistenceID == "" {
+		if err := row.Scan(&ordering, &persistenceID, &seqNr, &message, &tags, &createdAt); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := row.Scan(&ordering, &seqNr, &message, &tags, &createdAt); err != nil {
+			return nil, err
+		}
+	}
+
+	m, err := unmarshalMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	e := &persistence.Event{
+		PersistenceID: persistenceID,
+		SeqNr:         uint64(seqNr),
+		Message:       m,
+		Timestamp:     time.Unix(0, createdAt),
+		Offset:        uint64(ordering),
+	}
+	if err := json.Unmarshal([]byte(tags), &e.Tags); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (s *Store) ReadEvents(ctx context.Context, persistenceID string, from uint64, to uint64, fn func(e *persistence.Event) error) error {
+	rows, err := s.db.QueryContext(ctx, s.q.readEvents, persistenceID, clamp(from), clamp(to))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEvent(rows, persistenceID)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Events returns the events of persistenceID whose sequence number is between
+// from and to inclusive, in order.
+func (s *Store) Events(ctx context.Context, persistenceID string, from uint64, to uint64) ([]*persistence.Event, error) {
+	var events []*persistence.Event
+	err := s.ReadEvents(ctx, persistenceID, from, to, func(e *persistence.Event) error {
+		events = append(events, e)
+		return nil
+	})
+	return events, err
+}
+
+func (s *Store) EventsByTag(ctx context.Context, tag string, offset uint64, limit int, fn func(e *persistence.Event) error) error {
+	rows, err := s.db.QueryContext(ctx, s.q.eventsByTag, tag, clamp(offset), limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// The events are read before calling fn, fn may take long and would
+	// hold the connection.
+	var events []*persistence.Event
+	for rows.Next() {
+		e, err := scanEvent(rows, "")
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if !s.opts.dialect.OrderedCommits && len(events) > 0 {
+		settled, err := s.settled(ctx, offset, events[len(events)-1].Offset)
+		if err != nil {
+			return err
+		}
+		for i, e := range events {
+			if e.Offset > settled {
+				events = events[:i]
+				break
+			}
+		}
+	}
+
+	for _, e := range events {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxGapScan bounds how many orderings settled reads at once.
+const maxGapScan = 10000
+
+// settled returns the highest ordering up to to below which no event can
+// still appear: the orderings following offset are read, and the first gap
+// followed by an event more recent than the gap timeout stops them, the
+// transaction holding the missing ordering may not have committed yet.
+func (s *Store) settled(ctx context.Context, offset uint64, to uint64) (uint64, error) {
+	rows, err := s.db.QueryContext(ctx, s.q.orderings, clamp(offset), clamp(to), maxGapScan)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	recent := time.Now().Add(-s.opts.gapTimeout).UnixNano()
+	prev, n := offset, 0
+	for rows.Next() {
+		var ordering, createdAt int64
+		if err := rows.Scan(&ordering, &createdAt); err != nil {
+			return 0, err
+		}
+		n++
+		if uint64(ordering) != prev+1 && createdAt > recent {
+			return prev, nil
+		}
+		prev = uint64(ordering)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if n < maxGapScan {
+		return to, nil
+	}
+	return prev, nil
+}
+
+func (s *Store) HighestSeqNr(ctx context.Context, persistenceID string) (uint64, error) {
+	return s.highestSeqNr(ctx, s.db, persistenceID)
+}
+
+func (s *Store) DeleteEvents(ctx context.Context, persistenceID string, seqNr uint64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	highest, err := s.highestSeqNr(ctx, tx, persistenceID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.q.deleteHighest, persistenceID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.q.insertHighest, persistenceID, clamp(highest)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.q.deleteTags, persistenceID, clamp(seqNr)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.q.deleteEvents, persistenceID, clamp(seqNr)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) SaveSnapshot(ctx context.Context, snapshot *persistence.Snapshot) error {
+	state, err := marshalMessage(snapshot.State)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, s.q.deleteSnapshot, snapshot.PersistenceID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.q.insertSnapshot, snapshot.PersistenceID, clamp(snapshot.SeqNr), state, snapshot.Timestamp.UnixNano()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) LoadSnapshot(ctx context.Context, persistenceID string) (*persistence.Snapshot, bool, error) {
+	var (
+		seqNr, createdAt int64
+		data             []byte
+	)
+	err := s.db.QueryRowContext(ctx, s.q.loadSnapshot, persistenceID).Scan(&seqNr, &data, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	state, err := unmarshalMessage(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return &persistence.Snapshot{
+		PersistenceID: persistenceID,
+		SeqNr:         uint64(seqNr),
+		State:         state,
+		Timestamp:     time.Unix(0, createdAt),
+	}, true, nil
+}
+
+func (s *Store) DeleteSnapshot(ctx context.Context, persistenceID string) error {
+	_, err := s.db.ExecContext(ctx, s.q.deleteSnapshot, persistenceID)
+	return err
+}
+
+// LoadOffset returns the offset saved by a projection, so that a projection
+// over the journal keeps its offsets in the same database.
+func (s *Store) LoadOffset(ctx context.Context, projection string, tag string) (uint64, error) {
+	var offset int64
+	err := s.db.QueryRowContext(ctx, s.q.loadOffset, projection, tag).Scan(&offset)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint64(offset), nil
+}
+
+func (s *Store) SaveOffset(ctx context.Context, projection string, tag string, offset uint64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, s.q.deleteOffset, projection, tag); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.q.insertOffset, projection, tag, clamp(offset)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,213 @@
+package sqljournal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geniuscirno/go-actor/persistence"
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func openTestStore(t *testing.T) (*sql.DB, *Store) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "journal.db")
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return db, store
+}
+
+func event(id string, seqNr uint64, tags ...string) *persistence.Event {
+	return &persistence.Event{
+		PersistenceID: id,
+		SeqNr:         seqNr,
+		Message:       wrapperspb.Int64(int64(seqNr)),
+		Tags:          tags,
+		Timestamp:     time.Now(),
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db, _ := openTestStore(t)
+
+	// Opening again applies no migration twice.
+	store, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var version, count int
+	if err := db.QueryRow("SELECT MAX(version), COUNT(*) FROM schema_migrations").Scan(&version, &count); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(migrations(SQLite, "")); version != n || count != n {
+		t.Fatalf("got version %d in %d rows, want %d", version, count, n)
+	}
+}
+
+func TestWriteEventsBatched(t *testing.T) {
+	_, store := openTestStore(t)
+	ctx := context.Background()
+
+	if err := store.WriteEvents(ctx, []*persistence.Event{event("conflict", 1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers = 32
+	errs := make([]error, writers+1)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprint("p", i)
+			errs[i] = store.WriteEvents(ctx, []*persistence.Event{event(id, 1), event(id, 2)})
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs[writers] = store.WriteEvents(ctx, []*persistence.Event{event("conflict", 1)})
+	}()
+	wg.Wait()
+
+	for i, err := range errs[:writers] {
+		if err != nil {
+			t.Fatalf("write p%d: %v", i, err)
+		}
+	}
+	if !errors.Is(errs[writers], persistence.ErrSeqNrConflict) {
+		t.Fatalf("got %v for the conflicting write, want ErrSeqNrConflict", errs[writers])
+	}
+
+	for i := 0; i < writers; i++ {
+		events, err := store.Events(ctx, fmt.Sprint("p", i), 0, ^uint64(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[0].SeqNr != 1 || events[1].SeqNr != 2 {
+			t.Fatalf("p%d: got %d events", i, len(events))
+		}
+		if v := events[1].Message.(*wrapperspb.Int64Value).Value; v != 2 {
+			t.Fatalf("p%d: got message %d, want 2", i, v)
+		}
+	}
+}
+
+func TestEventsByTag(t *testing.T) {
+	_, store := openTestStore(t)
+	ctx := context.Background()
+
+	for seqNr := uint64(1); seqNr <= 6; seqNr++ {
+		tags := []string{"all"}
+		if seqNr%2 == 0 {
+			tags = append(tags, "even")
+		}
+		if err := store.WriteEvents(ctx, []*persistence.Event{event("p", seqNr, tags...)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(tag string, offset uint64, limit int) []*persistence.Event {
+		var events []*persistence.Event
+		err := store.EventsByTag(ctx, tag, offset, limit, func(e *persistence.Event) error {
+			events = append(events, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+
+	even := read("even", 0, 10)
+	if len(even) != 3 {
+		t.Fatalf("got %d even events, want 3", len(even))
+	}
+	for i, e := range even {
+		if e.SeqNr != uint64(i+1)*2 {
+			t.Fatalf("got seq nr %d at %d", e.SeqNr, i)
+		}
+		if i > 0 && e.Offset <= even[i-1].Offset {
+			t.Fatalf("offsets not increasing: %d after %d", e.Offset, even[i-1].Offset)
+		}
+	}
+
+	// Reading from the offset of an event resumes after it.
+	rest := read("even", even[0].Offset, 10)
+	if len(rest) != 2 || rest[0].SeqNr != 4 {
+		t.Fatalf("got %d events from offset %d", len(rest), even[0].Offset)
+	}
+	if limited := read("all", 0, 4); len(limited) != 4 {
+		t.Fatalf("got %d events with a limit of 4", len(limited))
+	}
+	if none := read("all", even[2].Offset, 10); len(none) != 0 {
+		t.Fatalf("got %d events after the last one", len(none))
+	}
+}
+
+func TestDeleteEvents(t *testing.T) {
+	_, store := openTestStore(t)
+	ctx := context.Background()
+
+	for seqNr := uint64(1); seqNr <= 5; seqNr++ {
+		if err := store.WriteEvents(ctx, []*persistence.Event{event("p", seqNr, "t")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.DeleteEvents(ctx, "p", 3); err != nil {
+		t.Fatal(err)
+	}
+	events, err := store.Events(ctx, "p", 0, ^uint64(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].SeqNr != 4 {
+		t.Fatalf("got %d events after deleting up to 3", len(events))
+	}
+	var tagged int
+	store.EventsByTag(ctx, "t", 0, 10, func(e *persistence.Event) error {
+		tagged++
+		return nil
+	})
+	if tagged != 2 {
+		t.Fatalf("got %d tagged events after deleting up to 3, want 2", tagged)
+	}
+
+	// The highest sequence number survives deleting every event, so that the
+	// numbering goes on.
+	if err := store.DeleteEvents(ctx, "p", 5); err != nil {
+		t.Fatal(err)
+	}
+	highest, err := store.HighestSeqNr(ctx, "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if highest != 5 {
+		t.Fatalf("got highest seq nr %d, want 5", highest)
+	}
+	if err := store.WriteEvents(ctx, []*persistence.Event{event("p", 5)}); !errors.Is(err, persistence.ErrSeqNrConflict) {
+		t.Fatalf("got %v reusing seq nr 5, want ErrSeqNrConflict", err)
+	}
+	if err := store.WriteEvents(ctx, []*persistence.Event{event("p", 6)}); err != nil {
+		t.Fatal(err)
+	}
+}
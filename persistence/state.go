@@ -0,0 +1,327 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/geniuscirno/go-actor/actor"
+	"github.com/geniuscirno/go-actor/internal/fileutil"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrVersionConflict is returned by SaveState when the state has been saved
+// by someone else since it was loaded.
+var ErrVersionConflict = errors.New("persistence: state version conflict")
+
+// StateStore stores the latest state of stateful actors, along with a version
+// changing on every save. Version 0 means no state has been saved.
+type StateStore interface {
+	// LoadState returns the state of id and its version, or a nil state and
+	// version 0 if there is none.
+	LoadState(ctx context.Context, id string) (proto.Message, uint64, error)
+	// SaveState stores state if the stored version is still version, and
+	// returns the new version.
+	SaveState(ctx context.Context, id string, state proto.Message, version uint64) (uint64, error)
+	// DeleteState removes the state of id. The versions it had are never
+	// returned again, so that saving with one of them keeps failing.
+	DeleteState(ctx context.Context, id string) error
+}
+
+type StatefulActor interface {
+	actor.Actor
+	StateID() string
+	// State returns the message holding the state of the actor, it is
+	// loaded in place when the actor starts.
+	State() proto.Message
+	initState(ctx context.Context, store StateStore, id string, state proto.Message)
+	setVersion(version uint64)
+}
+
+// StateMixin is embedded in stateful actors.
+type StateMixin struct {
+	store   StateStore
+	id      string
+	ctx     context.Context
+	state   proto.Message
+	version uint64
+}
+
+func (m *StateMixin) initState(ctx context.Context, store StateStore, id string, state proto.Message) {
+	m.store = store
+	m.id = id
+	m.ctx = ctx
+	m.state = state
+}
+
+func (m *StateMixin) setVersion(version uint64) {
+	m.version = version
+}
+
+// Version returns the version of the state last loaded or saved.
+func (m *StateMixin) Version() uint64 {
+	return m.version
+}
+
+// SaveState stores the state of the actor. It returns ErrVersionConflict if
+// another actor with the same id has saved it in the meantime, the actor may
+// then ReloadState and retry.
+func (m *StateMixin) SaveState() error {
+	ctx, cancel := context.WithTimeout(m.ctx, time.Second*5)
+	defer cancel()
+
+	version, err := m.store.SaveState(ctx, m.id, m.state, m.version)
+	if err != nil {
+		return err
+	}
+	m.version = version
+	return nil
+}
+
+// ReloadState replaces the state of the actor with the stored one.
+func (m *StateMixin) ReloadState() error {
+	ctx, cancel := context.WithTimeout(m.ctx, time.Second*5)
+	defer cancel()
+
+	version, err := loadState(ctx, m.store, m.id, m.state)
+	if err != nil {
+		return err
+	}
+	m.version = version
+	return nil
+}
+
+// ClearState deletes the stored state, the state of the actor is kept.
+func (m *StateMixin) ClearState() error {
+	ctx, cancel := context.WithTimeout(m.ctx, time.Second*5)
+	defer cancel()
+
+	if err := m.store.DeleteState(ctx, m.id); err != nil {
+		return err
+	}
+	m.version = 0
+	return nil
+}
+
+func loadState(ctx context.Context, store StateStore, id string, state proto.Message) (uint64, error) {
+	stored, version, err := store.LoadState(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	proto.Reset(state)
+	if stored != nil {
+		proto.Merge(state, stored)
+	}
+	return version, nil
+}
+
+type statefulActor struct {
+	store  StateStore
+	actor  StatefulActor
+	failed bool
+}
+
+// NewStatefulActor returns an actor loading the state of a from store before
+// it handles *actor.Started.
+func NewStatefulActor(store StateStore, a StatefulActor) actor.Actor {
+	return &statefulActor{store: store, actor: a}
+}
+
+func (s *statefulActor) Receive(c actor.Context) {
+	if s.failed {
+		return
+	}
+
+	if _, ok := c.Message().(*actor.Started); ok {
+		id, state := s.actor.StateID(), s.actor.State()
+		s.actor.initState(c.Context(), s.store, id, state)
+
+		ctx, cancel := context.WithTimeout(c.Context(), time.Second*5)
+		version, err := loadState(ctx, s.store, id, state)
+		cancel()
+		if err != nil {
+			// The actor would overwrite the stored state with an empty
+			// one, it is stopped instead.
+			log.Printf("persistence: load state %s failed: %v\n", id, err)
+			s.failed = true
+			c.Kill()
+			return
+		}
+		s.actor.setVersion(version)
+	}
+	s.actor.Receive(c)
+}
+
+type memoryStateStore struct {
+	mu     sync.RWMutex
+	states map[string]memoryState
+}
+
+// memoryState is the state of an id along with its version, a deleted state
+// is kept with a nil state as a tombstone holding the last version.
+type memoryState struct {
+	state   proto.Message
+	version uint64
+}
+
+// current returns the version SaveState expects, 0 once deleted.
+func (s memoryState) current() uint64 {
+	if s.state == nil {
+		return 0
+	}
+	return s.version
+}
+
+// NewMemoryStateStore returns a StateStore that does not survive restarts.
+func NewMemoryStateStore() StateStore {
+	return &memoryStateStore{states: make(map[string]memoryState)}
+}
+
+func (s *memoryStateStore) LoadState(ctx context.Context, id string) (proto.Message, uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state := s.states[id]
+	if state.state == nil {
+		return nil, 0, nil
+	}
+	return proto.Clone(state.state), state.version, nil
+}
+
+func (s *memoryStateStore) SaveState(ctx context.Context, id string, state proto.Message, version uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.states[id]
+	if prev.current() != version {
+		return 0, ErrVersionConflict
+	}
+	s.states[id] = memoryState{state: proto.Clone(state), version: prev.version + 1}
+	return prev.version + 1, nil
+}
+
+func (s *memoryStateStore) DeleteState(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state, ok := s.states[id]; ok {
+		s.states[id] = memoryState{version: state.version}
+	}
+	return nil
+}
+
+// fileState is the content of the file of a state. A deleted state is kept as
+// a tombstone holding the last version.
+type fileState struct {
+	Version uint64 `json:"version"`
+	Data    []byte `json:"data"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// current returns the version SaveState expects, 0 once deleted.
+func (fs *fileState) current() uint64 {
+	if fs.Deleted {
+		return 0
+	}
+	return fs.Version
+}
+
+type fileStateStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStateStore returns a StateStore keeping every state in a JSON file
+// under dir. Versions are checked among the actors of this process only, the
+// directory must not be shared.
+func NewFileStateStore(dir string) (StateStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileStateStore{dir: dir}, nil
+}
+
+func (s *fileStateStore) path(id string) string {
+	return filepath.Join(s.dir, url.PathEscape(id)+".state")
+}
+
+func (s *fileStateStore) read(id string) (*fileState, error) {
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return &fileState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &fileState{}
+	if err := json.Unmarshal(b, fs); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (s *fileStateStore) LoadState(ctx context.Context, id string) (proto.Message, uint64, error) {
+	s.mu.Lock()
+	fs, err := s.read(id)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, 0, err
+	}
+	if fs.current() == 0 {
+		return nil, 0, nil
+	}
+
+	state, err := unmarshalMessage(fs.Data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return state, fs.Version, nil
+}
+
+func (s *fileStateStore) SaveState(ctx context.Context, id string, state proto.Message, version uint64) (uint64, error) {
+	data, err := marshalMessage(state)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fs, err := s.read(id)
+	if err != nil {
+		return 0, err
+	}
+	if fs.current() != version {
+		return 0, ErrVersionConflict
+	}
+	b, err := json.Marshal(&fileState{Version: fs.Version + 1, Data: data})
+	if err != nil {
+		return 0, err
+	}
+	if err := fileutil.WriteFile(s.path(id), b); err != nil {
+		return 0, err
+	}
+	return fs.Version + 1, nil
+}
+
+func (s *fileStateStore) DeleteState(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fs, err := s.read(id)
+	if err != nil || fs.current() == 0 {
+		return err
+	}
+	b, err := json.Marshal(&fileState{Version: fs.Version, Deleted: true})
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(s.path(id), b)
+}
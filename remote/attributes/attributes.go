@@ -31,6 +31,9 @@ func (a *Attributes) Match(o *Attributes) bool {
 	if o == nil {
 		return true
 	}
+	if a == nil {
+		return len(o.m) == 0
+	}
 
 	for k, v := range o.m {
 		val, ok := a.m[k]
@@ -7,16 +7,39 @@ import (
 	"github.com/geniuscirno/go-actor/core"
 	"github.com/geniuscirno/go-actor/remote/attributes"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
+	"io"
 	"log"
+	"sync"
+	"time"
 )
 
 type Endpoint struct {
 	Name       string
 	Addr       string
 	Attributes *attributes.Attributes
+	Kinds      []string
 	conn       *grpc.ClientConn
+
+	mu      sync.Mutex
+	streams map[string]*endpointStream
+}
+
+// streamIdleTimeout is how long a gRPC stream is kept without frames.
+const streamIdleTimeout = time.Minute
+
+// endpointStream carries the frames of one direction of an actor stream over
+// a single gRPC stream so they arrive in order.
+type endpointStream struct {
+	mu     sync.Mutex
+	client Remote_OnStreamClient
+	cancel context.CancelFunc
+	last   time.Time
+	idle   *time.Timer
+	closed bool
 }
 
 func NewEndpoint(nodeName string, addr string) (*Endpoint, error) {
@@ -25,13 +48,21 @@ func NewEndpoint(nodeName string, addr string) (*Endpoint, error) {
 		return nil, err
 	}
 	return &Endpoint{
-		Name: nodeName,
-		Addr: addr,
-		conn: conn,
+		Name:    nodeName,
+		Addr:    addr,
+		conn:    conn,
+		streams: make(map[string]*endpointStream),
 	}, nil
 }
 
 func (ep *Endpoint) Close() error {
+	ep.mu.Lock()
+	for key, s := range ep.streams {
+		s.idle.Stop()
+		s.cancel()
+		delete(ep.streams, key)
+	}
+	ep.mu.Unlock()
 	return ep.conn.Close()
 }
 
@@ -40,27 +71,140 @@ func (ep *Endpoint) SendMessage(ctx context.Context, to core.PID, message core.M
 		return errors.New("node unmatch")
 	}
 
-	protoMessage, ok := message.Data.(proto.Message)
-	if !ok {
-		return fmt.Errorf("remote message must be a proto message")
-	}
-
-	data, err := Marshal(protoMessage)
+	request, err := newOnMessageRequest(to, message)
 	if err != nil {
 		return err
 	}
 
+	if message.TestFlag(core.MessageFlagStream) {
+		return ep.sendStreamMessage(to, message, request)
+	}
+
 	client := NewRemoteClient(ep.conn)
 
-	log.Printf("cluster: send message from %v to %v: %v\n", message.From, to, data)
-	_, err = client.OnMessage(ctx, &OnMessageRequest{
+	log.Printf("cluster: send message from %v to %v: %v\n", message.From, to, request.Message.Data)
+	_, err = client.OnMessage(ctx, request)
+	if status.Code(err) == codes.NotFound {
+		return core.ErrProcessNotFound
+	}
+	return err
+}
+
+func (ep *Endpoint) sendStreamMessage(to core.PID, message core.Message, request *OnMessageRequest) error {
+	key := message.From.String() + ">" + to.String()
+
+	for {
+		s, err := ep.stream(key)
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			// Closed by the reaper in between, a new stream carries the frame.
+			s.mu.Unlock()
+			continue
+		}
+		s.last = time.Now()
+		err = s.client.Send(request)
+		if err == nil && !message.TestFlag(core.MessageFlagStreamEnd) {
+			s.mu.Unlock()
+			return nil
+		}
+		err = ep.closeStream(key, s, err)
+		s.mu.Unlock()
+		return err
+	}
+}
+
+// stream returns the gRPC stream of key, opening it if needed.
+func (ep *Endpoint) stream(key string) (*endpointStream, error) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	if s, ok := ep.streams[key]; ok {
+		return s, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := NewRemoteClient(ep.conn).OnStream(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s := &endpointStream{client: client, cancel: cancel, last: time.Now()}
+	s.idle = time.AfterFunc(streamIdleTimeout, func() { ep.reapStream(key, s) })
+	ep.streams[key] = s
+	return s, nil
+}
+
+// closeStream closes s after its last frame or a failed send, s.mu must be
+// held.
+func (ep *Endpoint) closeStream(key string, s *endpointStream, err error) error {
+	s.closed = true
+	s.idle.Stop()
+
+	ep.mu.Lock()
+	if ep.streams[key] == s {
+		delete(ep.streams, key)
+	}
+	ep.mu.Unlock()
+
+	// Send only reports io.EOF when the server has given up on the stream,
+	// the actual error comes from CloseAndRecv.
+	_, closeErr := s.client.CloseAndRecv()
+	s.cancel()
+	if err == nil || err == io.EOF {
+		err = closeErr
+	}
+	if status.Code(err) == codes.NotFound {
+		return core.ErrProcessNotFound
+	}
+	return err
+}
+
+// reapStream closes s once no frame has been sent on it for
+// streamIdleTimeout, its last frame may never come if the sender died. The
+// frames sent later go over a new stream.
+func (ep *Endpoint) reapStream(key string, s *endpointStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	if idle := time.Since(s.last); idle < streamIdleTimeout {
+		s.idle.Reset(streamIdleTimeout - idle)
+		return
+	}
+	ep.closeStream(key, s, nil)
+}
+
+func newOnMessageRequest(to core.PID, message core.Message) (*OnMessageRequest, error) {
+	var protoMessage proto.Message
+	switch data := message.Data.(type) {
+	case proto.Message:
+		protoMessage = data
+	case error:
+		protoMessage = newError(data)
+	default:
+		return nil, fmt.Errorf("remote message must be a proto message")
+	}
+
+	data, err := Marshal(protoMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OnMessageRequest{
 		To: &PID{Node: to.Node, Id: to.ID},
 		Message: &Message{
 			From:      &PID{Node: message.From.Node, Id: message.From.ID},
 			RequestId: message.RequestID,
 			Data:      data,
 			Flag:      message.Flag,
+			SentAt:    timeToUnixNano(message.SentAt),
+			Deadline:  timeToUnixNano(message.Deadline),
+			Header:    message.Header,
 		},
-	})
-	return err
+	}, nil
 }
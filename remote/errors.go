@@ -1,7 +1,43 @@
 package remote
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/geniuscirno/go-actor/core"
+)
+
+// The well-known errors are sent with a code, so that errors.Is matches the
+// *Error received on the other node.
+var codeErrors = map[int32]error{
+	1: core.ErrTimeout,
+	2: core.ErrProcessNotFound,
+	3: core.ErrProcessBusy,
+	4: core.ErrDupProcessName,
+	5: context.DeadlineExceeded,
+	6: context.Canceled,
+}
+
+// errorCode returns the code of err, zero if it is not a well-known error.
+func errorCode(err error) int32 {
+	for code, e := range codeErrors {
+		if errors.Is(err, e) {
+			return code
+		}
+	}
+	return 0
+}
+
+func newError(err error) *Error {
+	return &Error{Code: errorCode(err), Msg: err.Error()}
+}
 
 func (e *Error) Error() string {
 	return fmt.Sprintf("%d %s", e.Code, e.Msg)
 }
+
+// Unwrap returns the well-known error of the code of e.
+func (e *Error) Unwrap() error {
+	return codeErrors[e.Code]
+}
@@ -23,6 +23,7 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type RemoteClient interface {
 	OnMessage(ctx context.Context, in *OnMessageRequest, opts ...grpc.CallOption) (*OnMessageReply, error)
+	OnStream(ctx context.Context, opts ...grpc.CallOption) (Remote_OnStreamClient, error)
 }
 
 type remoteClient struct {
@@ -42,11 +43,46 @@ func (c *remoteClient) OnMessage(ctx context.Context, in *OnMessageRequest, opts
 	return out, nil
 }
 
+func (c *remoteClient) OnStream(ctx context.Context, opts ...grpc.CallOption) (Remote_OnStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Remote_ServiceDesc.Streams[0], "/remote.Remote/OnStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &remoteOnStreamClient{stream}
+	return x, nil
+}
+
+type Remote_OnStreamClient interface {
+	Send(*OnMessageRequest) error
+	CloseAndRecv() (*OnMessageReply, error)
+	grpc.ClientStream
+}
+
+type remoteOnStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *remoteOnStreamClient) Send(m *OnMessageRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *remoteOnStreamClient) CloseAndRecv() (*OnMessageReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(OnMessageReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // RemoteServer is the server API for Remote service.
 // All implementations must embed UnimplementedRemoteServer
 // for forward compatibility
 type RemoteServer interface {
 	OnMessage(context.Context, *OnMessageRequest) (*OnMessageReply, error)
+	OnStream(Remote_OnStreamServer) error
 	mustEmbedUnimplementedRemoteServer()
 }
 
@@ -57,6 +93,9 @@ type UnimplementedRemoteServer struct {
 func (UnimplementedRemoteServer) OnMessage(context.Context, *OnMessageRequest) (*OnMessageReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method OnMessage not implemented")
 }
+func (UnimplementedRemoteServer) OnStream(Remote_OnStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method OnStream not implemented")
+}
 func (UnimplementedRemoteServer) mustEmbedUnimplementedRemoteServer() {}
 
 // UnsafeRemoteServer may be embedded to opt out of forward compatibility for this service.
@@ -88,6 +127,32 @@ func _Remote_OnMessage_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Remote_OnStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RemoteServer).OnStream(&remoteOnStreamServer{stream})
+}
+
+type Remote_OnStreamServer interface {
+	SendAndClose(*OnMessageReply) error
+	Recv() (*OnMessageRequest, error)
+	grpc.ServerStream
+}
+
+type remoteOnStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *remoteOnStreamServer) SendAndClose(m *OnMessageReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *remoteOnStreamServer) Recv() (*OnMessageRequest, error) {
+	m := new(OnMessageRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Remote_ServiceDesc is the grpc.ServiceDesc for Remote service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -100,6 +165,12 @@ var Remote_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _Remote_OnMessage_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "OnStream",
+			Handler:       _Remote_OnStream_Handler,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "remote/remote.proto",
 }
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"github.com/geniuscirno/go-actor/core"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
 	"log"
 	"net"
 	"strings"
@@ -46,15 +49,39 @@ func (s *Server) Stop() {
 }
 
 func (s *Server) OnMessage(ctx context.Context, in *OnMessageRequest) (*OnMessageReply, error) {
+	if err := s.deliver(ctx, in); err != nil {
+		return nil, err
+	}
+	return &OnMessageReply{}, nil
+}
+
+// OnStream delivers the frames of one direction of an actor stream in the
+// order they were sent.
+func (s *Server) OnStream(stream Remote_OnStreamServer) error {
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&OnMessageReply{})
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.deliver(stream.Context(), in); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) deliver(ctx context.Context, in *OnMessageRequest) error {
 	if in.To.Node != s.node.Name() {
-		return nil, errors.New("not this node")
+		return errors.New("not this node")
 	}
 
 	to := core.PID{Node: in.To.Node, ID: in.To.Id}
 
 	data, err := Unmarshal(in.Message.Data)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	log.Printf("cluster: recv message from %s@%s to %v: %v\n", in.Message.From.Id, in.Message.From.Node, to, data)
 
@@ -63,11 +90,16 @@ func (s *Server) OnMessage(ctx context.Context, in *OnMessageRequest) (*OnMessag
 		RequestID: in.Message.RequestId,
 		Data:      data,
 		Flag:      in.Message.Flag,
+		SentAt:    unixNanoToTime(in.Message.SentAt),
+		Deadline:  unixNanoToTime(in.Message.Deadline),
+		Header:    in.Message.Header,
 	}); err != nil {
-		return nil, err
+		if errors.Is(err, core.ErrProcessNotFound) {
+			return status.Error(codes.NotFound, err.Error())
+		}
+		return err
 	}
-
-	return &OnMessageReply{}, nil
+	return nil
 }
 
 func (s *Server) mustEmbedUnimplementedRemoteServer() {}
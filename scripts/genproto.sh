@@ -8,7 +8,8 @@ if ! [[ "$0" =~ scripts/genproto.sh ]]; then
 fi
 
 protoc -I . --go_out=paths=source_relative:. \
- actor/*.proto
+ actor/*.proto \
+ cluster/pubsub/*.proto
 
 protoc -I . --go_out=paths=source_relative:. \
  --go-grpc_out=paths=source_relative:. \